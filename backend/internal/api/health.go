@@ -4,16 +4,36 @@ import (
 	"encoding/json"
 	"net/http"
 	"runtime"
+	"sync"
 	"time"
 )
 
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Timestamp time.Time         `json:"timestamp"`
-	Version   string            `json:"version"`
-	Uptime    string            `json:"uptime"`
-	System    SystemInfo        `json:"system"`
-	Services  map[string]string `json:"services"`
+	Status    string                 `json:"status"`
+	Timestamp time.Time              `json:"timestamp"`
+	Version   string                 `json:"version"`
+	Uptime    string                 `json:"uptime"`
+	System    SystemInfo             `json:"system"`
+	Services  map[string]string      `json:"services"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// HealthCheck retorna o estado de um serviço ("ok" quando saudável) e
+// detalhes opcionais exibidos em /health.
+type HealthCheck func() (status string, details interface{})
+
+var (
+	healthMu     sync.RWMutex
+	healthChecks = make(map[string]HealthCheck)
+)
+
+// RegisterHealthCheck faz /health consultar check para o serviço name.
+// Qualquer estado diferente de "ok" marca a resposta como "degraded".
+func RegisterHealthCheck(name string, check HealthCheck) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	healthChecks[name] = check
 }
 
 type SystemInfo struct {
@@ -56,6 +76,22 @@ func HandleHealth(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	healthMu.RLock()
+	for name, check := range healthChecks {
+		status, details := check()
+		health.Services[name] = status
+		if status != "ok" {
+			health.Status = "degraded"
+		}
+		if details != nil {
+			if health.Details == nil {
+				health.Details = make(map[string]interface{})
+			}
+			health.Details[name] = details
+		}
+	}
+	healthMu.RUnlock()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(health)
 }
@@ -3,26 +3,16 @@ package api
 import (
 	"errors"
 	"path/filepath"
-	"regexp"
 	"strings"
-)
 
-var magnetLinkRegex = regexp.MustCompile(`^magnet:\?xt=urn:btih:[a-fA-F0-9]{40}`)
+	"nebula/backend/internal/magnet"
+)
 
+// ValidateMagnetLink aceita magnet links v1, v2 e híbridos, além de info
+// hashes soltos.
 func ValidateMagnetLink(magnetLink string) error {
-	if magnetLink == "" {
-		return errors.New("magnet link cannot be empty")
-	}
-
-	if !strings.HasPrefix(magnetLink, "magnet:?") {
-		return errors.New("invalid magnet link format")
-	}
-
-	if !magnetLinkRegex.MatchString(magnetLink) {
-		return errors.New("invalid magnet link: missing or invalid info hash")
-	}
-
-	return nil
+	_, err := magnet.Parse(magnetLink)
+	return err
 }
 
 func ValidateOutputDir(outputDir string) error {
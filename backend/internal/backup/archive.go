@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"nebula/backend/internal/config"
+	"nebula/backend/internal/downloader"
+)
+
+// FormatVersion é a versão do formato gravada no manifesto. Read aceita
+// backups até esta versão.
+const FormatVersion = 1
+
+// maxEntrySize limita cada arquivo descompactado, contra zips maliciosos.
+const maxEntrySize = 64 << 20
+
+// Arquivos dentro do zip
+const (
+	manifestFile  = "manifest.json"
+	configFile    = "config.json"
+	apiKeyFile    = "api_key"
+	downloadsFile = "downloads.json"
+	historyFile   = "history.json"
+	favoritesFile = "favorites.json"
+	torrentsDir   = "torrents/"
+)
+
+// Manifest descreve o backup. As contagens são conferidas por Read.
+type Manifest struct {
+	Version        int       `json:"version"`
+	CreatedAt      time.Time `json:"created_at"`
+	APIKeyIncluded bool      `json:"api_key_included"`
+	Downloads      int       `json:"downloads"`
+	History        int       `json:"history"`
+	Favorites      int       `json:"favorites"`
+	Torrents       int       `json:"torrents"`
+}
+
+// Archive é o conteúdo de um backup. APIKey vazia significa que a chave foi
+// omitida.
+type Archive struct {
+	Manifest Manifest
+	Config   *config.AppConfig
+	APIKey   string
+	Data     *downloader.Snapshot
+	Torrents []downloader.StoredTorrent
+}
+
+// Write grava a como zip e preenche o manifesto.
+func Write(w io.Writer, a *Archive) error {
+	a.Manifest = Manifest{
+		Version:        FormatVersion,
+		CreatedAt:      time.Now().UTC(),
+		APIKeyIncluded: a.APIKey != "",
+		Downloads:      len(a.Data.Downloads),
+		History:        len(a.Data.History),
+		Favorites:      len(a.Data.Favorites),
+		Torrents:       len(a.Torrents),
+	}
+
+	zw := zip.NewWriter(w)
+	entries := []struct {
+		name string
+		v    interface{}
+	}{
+		{manifestFile, a.Manifest},
+		{configFile, a.Config},
+		{downloadsFile, a.Data.Downloads},
+		{historyFile, a.Data.History},
+		{favoritesFile, a.Data.Favorites},
+	}
+	for _, e := range entries {
+		data, err := json.MarshalIndent(e.v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", e.name, err)
+		}
+		if err := writeEntry(zw, e.name, data); err != nil {
+			return err
+		}
+	}
+	if a.APIKey != "" {
+		if err := writeEntry(zw, apiKeyFile, []byte(a.APIKey)); err != nil {
+			return err
+		}
+	}
+	for _, t := range a.Torrents {
+		if err := writeEntry(zw, torrentsDir+t.InfoHash+".torrent", t.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeEntry(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Read valida um backup gerado por Write: manifesto, configuração, registros
+// e cada .torrent. Qualquer erro rejeita o backup inteiro.
+func Read(data []byte) (*Archive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	a := &Archive{Data: &downloader.Snapshot{}}
+	if err := readJSON(files, manifestFile, &a.Manifest, true); err != nil {
+		return nil, err
+	}
+	if a.Manifest.Version < 1 || a.Manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d (supported up to %d)", a.Manifest.Version, FormatVersion)
+	}
+
+	raw, err := readEntry(files, configFile, true)
+	if err != nil {
+		return nil, err
+	}
+	if a.Config, err = config.ParseConfig(raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	if err := readJSON(files, downloadsFile, &a.Data.Downloads, false); err != nil {
+		return nil, err
+	}
+	if err := readJSON(files, historyFile, &a.Data.History, false); err != nil {
+		return nil, err
+	}
+	if err := readJSON(files, favoritesFile, &a.Data.Favorites, false); err != nil {
+		return nil, err
+	}
+
+	if raw, err := readEntry(files, apiKeyFile, false); err != nil {
+		return nil, err
+	} else if raw != nil {
+		a.APIKey = strings.TrimSpace(string(raw))
+		if len(a.APIKey) < 32 {
+			return nil, fmt.Errorf("%s: api key must have at least 32 characters", apiKeyFile)
+		}
+	}
+
+	for _, f := range zr.File {
+		dir, name := path.Split(f.Name)
+		if dir != torrentsDir || name == "" {
+			continue
+		}
+		raw, err := readEntry(files, f.Name, true)
+		if err != nil {
+			return nil, err
+		}
+		t := downloader.StoredTorrent{InfoHash: strings.TrimSuffix(name, ".torrent"), Data: raw}
+		if err := downloader.ValidateTorrentFile(t.InfoHash, t.Data); err != nil {
+			return nil, err
+		}
+		a.Torrents = append(a.Torrents, t)
+	}
+
+	m := a.Manifest
+	if m.Downloads != len(a.Data.Downloads) || m.History != len(a.Data.History) ||
+		m.Favorites != len(a.Data.Favorites) || m.Torrents != len(a.Torrents) {
+		return nil, fmt.Errorf("backup contents do not match the manifest")
+	}
+	return a, nil
+}
+
+// readEntry lê um arquivo do zip. Arquivos opcionais ausentes retornam nil.
+func readEntry(files map[string]*zip.File, name string, required bool) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		if required {
+			return nil, fmt.Errorf("backup is missing %s", name)
+		}
+		return nil, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxEntrySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	if len(data) > maxEntrySize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", name, maxEntrySize)
+	}
+	return data, nil
+}
+
+func readJSON(files map[string]*zip.File, name string, v interface{}, required bool) error {
+	data, err := readEntry(files, name, required)
+	if err != nil || data == nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -5,7 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
+	"time"
+
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/fileutil"
+	"nebula/backend/internal/postprocess"
+	"nebula/backend/internal/selection"
 )
 
 type AppConfig struct {
@@ -25,6 +32,61 @@ type AppConfig struct {
 
 	MaxConnections int `json:"max_connections"`
 	RequestTimeout int `json:"request_timeout"`
+
+	// StorageBackend: "file" (padrão), "mmap" ou "memory". Aplicado ao
+	// reiniciar o backend.
+	StorageBackend string `json:"storage_backend"`
+
+	// PersistenceBackend: "json" (padrão) ou "sqlite" para downloads,
+	// histórico e favoritos. Aplicado ao reiniciar; o SQLite importa os
+	// arquivos JSON na primeira vez.
+	PersistenceBackend string `json:"persistence_backend"`
+
+	// Preallocate reserva o tamanho final dos arquivos selecionados ao
+	// iniciar o download (apenas com o backend de arquivos).
+	Preallocate bool `json:"preallocate"`
+
+	// Espaço em disco: DiskReserve é mantido livre ao iniciar um download;
+	// LowSpacePolicy "queue" faz o download aguardar espaço em vez de falhar.
+	// Abaixo de LowSpaceThreshold todos os downloads são pausados (0 desativa).
+	DiskReserve       int64  `json:"disk_reserve"`
+	LowSpacePolicy    string `json:"low_space_policy"`
+	LowSpaceThreshold int64  `json:"low_space_threshold"`
+
+	// Extração automática de zip/tar após a conclusão
+	AutoExtract           bool `json:"auto_extract"`
+	ExtractDeleteArchives bool `json:"extract_delete_archives"`
+
+	// Ações executadas após todo download concluído, depois das ações do
+	// próprio download.
+	OnComplete []postprocess.Action `json:"on_complete"`
+
+	// Regras de seleção de arquivos nomeadas, usadas por "preset" nos
+	// pedidos de download.
+	SelectionPresets map[string]selection.Rules `json:"selection_presets"`
+
+	// Presets de download (destino, seleção, limites, seeding, tags e
+	// ações), referenciados por "download_preset" nos pedidos.
+	DownloadPresets map[string]DownloadPreset `json:"download_presets"`
+
+	// Retenção do histórico: entradas além de HistoryMaxEntries ou não
+	// acessadas há mais de HistoryMaxAgeDays são descartadas (0 desativa).
+	HistoryMaxEntries int `json:"history_max_entries"`
+	HistoryMaxAgeDays int `json:"history_max_age_days"`
+
+	// DisableHistory torna todo download privado: nada vai para o histórico
+	// e registros concluídos não ficam em downloads.json.
+	DisableHistory bool `json:"disable_history"`
+
+	// LogLevel é o nível mínimo registrado: debug, info, warn ou error.
+	LogLevel string `json:"log_level"`
+
+	// Limites da API em requisições por segundo, no total e por IP, com as
+	// rajadas permitidas.
+	RateLimit        int `json:"rate_limit"`
+	RateLimitBurst   int `json:"rate_limit_burst"`
+	IPRateLimit      int `json:"ip_rate_limit"`
+	IPRateLimitBurst int `json:"ip_rate_limit_burst"`
 }
 
 func DefaultConfig() *AppConfig {
@@ -44,6 +106,18 @@ func DefaultConfig() *AppConfig {
 		ProxyPort:          0,
 		MaxConnections:     0,
 		RequestTimeout:     30,
+		StorageBackend:     "file",
+		PersistenceBackend: downloader.StoreJSON,
+		DiskReserve:        1 << 30,
+		LowSpacePolicy:     "refuse",
+		LowSpaceThreshold:  512 << 20,
+		SelectionPresets:   selection.DefaultPresets(),
+		HistoryMaxEntries:  1000,
+		LogLevel:           "info",
+		RateLimit:          100,
+		RateLimitBurst:     200,
+		IPRateLimit:        20,
+		IPRateLimitBurst:   50,
 	}
 }
 
@@ -51,15 +125,29 @@ type ConfigManager struct {
 	config *AppConfig
 	path   string
 	mu     sync.RWMutex
+
+	// saveMu serializa gravações e recargas do arquivo, de modo que os
+	// inscritos recebem as mudanças na ordem em que foram aplicadas.
+	// applied é a última configuração publicada e file o estado do arquivo
+	// gravado ou lido por último.
+	saveMu      sync.Mutex
+	applied     *AppConfig
+	file        fileState
+	subscribers map[int]func(Change)
+	nextSub     int
+	subMu       sync.Mutex
+
+	// overrides são os valores fixados por Override, indexados pelo campo
+	overrides map[int]reflect.Value
 }
 
-func NewConfigManager(configDir string) (*ConfigManager, error) {
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+// NewConfigManager carrega a configuração do arquivo configPath, criando o
+// diretório se preciso. Sem o arquivo valem os padrões.
+func NewConfigManager(configPath string) (*ConfigManager, error) {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return nil, fmt.Errorf("create config dir: %w", err)
 	}
 
-	configPath := filepath.Join(configDir, "config.json")
-
 	cm := &ConfigManager{
 		config: DefaultConfig(),
 		path:   configPath,
@@ -68,6 +156,8 @@ func NewConfigManager(configDir string) (*ConfigManager, error) {
 	if err := cm.Load(); err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("load config: %w", err)
 	}
+	cm.applied = cm.Get()
+	cm.file = readFileState(configPath)
 
 	return cm, nil
 }
@@ -81,79 +171,192 @@ func (cm *ConfigManager) Load() error {
 		return err
 	}
 
+	config, err := decodeConfig(data)
+	if err != nil {
+		return err
+	}
+
+	cm.config = config
+	return nil
+}
+
+// decodeConfig lê data sobre DefaultConfig, de modo que campos ausentes
+// fiquem com os valores padrão.
+func decodeConfig(data []byte) (*AppConfig, error) {
 	config := DefaultConfig()
+	// Presets removidos pelo usuário não devem voltar pelos padrões
+	config.SelectionPresets = nil
 	if err := json.Unmarshal(data, config); err != nil {
-		return fmt.Errorf("unmarshal config: %w", err)
+		return nil, fmt.Errorf("unmarshal config: %w", err)
 	}
+	if config.SelectionPresets == nil {
+		config.SelectionPresets = selection.DefaultPresets()
+	}
+	return config, nil
+}
+
+// ParseConfig lê uma configuração completa, como a de um backup ou o
+// arquivo editado à mão, e a valida com as mesmas regras de Patch.
+func ParseConfig(data []byte) (*AppConfig, error) {
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
+// Replace troca toda a configuração (obtida de ParseConfig) e a grava.
+func (cm *ConfigManager) Replace(config *AppConfig) error {
+	cm.mu.Lock()
 	cm.config = config
-	return nil
+	cm.mu.Unlock()
+
+	return cm.Save()
 }
 
+// Save grava a configuração atual e publica o que mudou aos inscritos.
 func (cm *ConfigManager) Save() error {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
+	cm.saveMu.Lock()
+	defer cm.saveMu.Unlock()
 
-	data, err := json.MarshalIndent(cm.config, "", "  ")
+	data, err := json.MarshalIndent(cm.Stored(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(cm.path, data, 0644); err != nil {
+	if err := fileutil.WriteFileAtomic(cm.path, data, 0644); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
+	cm.file = readFileState(cm.path)
 
+	cm.publish(cm.Get(), SourceAPI)
 	return nil
 }
 
+// Get retorna uma cópia da configuração efetiva, com os valores de Override.
 func (cm *ConfigManager) Get() *AppConfig {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
 	cfg := *cm.config
+	v := reflect.ValueOf(&cfg).Elem()
+	for i, value := range cm.overrides {
+		v.Field(i).Set(value)
+	}
 	return &cfg
 }
 
+// Stored retorna uma cópia da configuração como é gravada no arquivo, sem os
+// valores de Override.
+func (cm *ConfigManager) Stored() *AppConfig {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	cfg := *cm.config
+	return &cfg
+}
+
+// Set altera um campo pela chave json, com as mesmas regras de Patch.
 func (cm *ConfigManager) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	_, err = cm.Patch(map[string]json.RawMessage{key: raw})
+	return err
+}
+
+func (cm *ConfigManager) SetOnComplete(actions []postprocess.Action) error {
+	if err := postprocess.ValidateActions(actions); err != nil {
+		return err
+	}
+
 	cm.mu.Lock()
-	defer cm.mu.Unlock()
+	cm.config.OnComplete = actions
+	cm.mu.Unlock()
 
-	switch key {
-	case "max_download_speed":
-		if v, ok := value.(int64); ok {
-			cm.config.MaxDownloadSpeed = v
-		}
-	case "max_upload_speed":
-		if v, ok := value.(int64); ok {
-			cm.config.MaxUploadSpeed = v
-		}
-	case "theme":
-		if v, ok := value.(string); ok {
-			cm.config.Theme = v
-		}
-	case "compact":
-		if v, ok := value.(bool); ok {
-			cm.config.Compact = v
-		}
-	case "notifications":
-		if v, ok := value.(bool); ok {
-			cm.config.Notifications = v
-		}
-	case "default_download_dir":
-		if v, ok := value.(string); ok {
-			cm.config.DefaultDownloadDir = v
-		}
-	case "max_connections":
-		if v, ok := value.(int); ok {
-			cm.config.MaxConnections = v
-		}
-	case "request_timeout":
-		if v, ok := value.(int); ok {
-			cm.config.RequestTimeout = v
+	return cm.Save()
+}
+
+// SetHistoryRetention define os limites do histórico.
+func (cm *ConfigManager) SetHistoryRetention(maxEntries, maxAgeDays int) error {
+	if maxEntries < 0 || maxAgeDays < 0 {
+		return fmt.Errorf("history retention cannot be negative")
+	}
+
+	cm.mu.Lock()
+	cm.config.HistoryMaxEntries = maxEntries
+	cm.config.HistoryMaxAgeDays = maxAgeDays
+	cm.mu.Unlock()
+
+	return cm.Save()
+}
+
+// HistoryRetention converte os limites configurados para o PersistenceManager.
+func (cm *ConfigManager) HistoryRetention() downloader.HistoryRetention {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return downloader.HistoryRetention{
+		MaxEntries: cm.config.HistoryMaxEntries,
+		MaxAge:     time.Duration(cm.config.HistoryMaxAgeDays) * 24 * time.Hour,
+	}
+}
+
+// SelectionPreset retorna as regras de seleção salvas com o nome dado.
+func (cm *ConfigManager) SelectionPreset(name string) (selection.Rules, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	rules, ok := cm.config.SelectionPresets[name]
+	return rules, ok
+}
+
+// SetSelectionPreset cria ou substitui um preset de seleção. O mapa é
+// copiado porque cópias retornadas por Get compartilham a referência.
+func (cm *ConfigManager) SetSelectionPreset(name string, rules selection.Rules) error {
+	if name == "" {
+		return fmt.Errorf("preset name is required")
+	}
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	presets := make(map[string]selection.Rules, len(cm.config.SelectionPresets)+1)
+	for k, v := range cm.config.SelectionPresets {
+		presets[k] = v
+	}
+	presets[name] = rules
+	cm.config.SelectionPresets = presets
+	cm.mu.Unlock()
+
+	return cm.Save()
+}
+
+// DeleteSelectionPreset remove um preset de seleção. Presets ainda usados
+// por presets de download são recusados com *PresetInUseError.
+func (cm *ConfigManager) DeleteSelectionPreset(name string) error {
+	cm.mu.Lock()
+	if _, ok := cm.config.SelectionPresets[name]; !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("selection preset not found: %s", name)
+	}
+	if usedBy := downloadPresetsUsing(cm.config, name); len(usedBy) > 0 {
+		cm.mu.Unlock()
+		return &PresetInUseError{Preset: name, UsedBy: usedBy}
+	}
+	presets := make(map[string]selection.Rules, len(cm.config.SelectionPresets))
+	for k, v := range cm.config.SelectionPresets {
+		if k != name {
+			presets[k] = v
 		}
-	default:
-		return fmt.Errorf("unknown config key: %s", key)
 	}
+	cm.config.SelectionPresets = presets
+	cm.mu.Unlock()
 
 	return cm.Save()
 }
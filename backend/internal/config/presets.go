@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/postprocess"
+	"nebula/backend/internal/selection"
+)
+
+// DownloadPreset agrupa opções reutilizáveis de download. Campos vazios não
+// alteram o padrão; cada campo pode ser sobreposto no pedido.
+type DownloadPreset struct {
+	OutputDir string `json:"output_dir,omitempty"`
+
+	// Seleção: nome de um preset de seleção ou regras próprias
+	SelectionPreset string           `json:"selection_preset,omitempty"`
+	Rules           *selection.Rules `json:"rules,omitempty"`
+
+	Sequential bool `json:"sequential,omitempty"`
+
+	downloader.TransferOptions
+
+	Tags            []string             `json:"tags,omitempty"`
+	OnComplete      []postprocess.Action `json:"on_complete,omitempty"`
+	ExtractArchives *bool                `json:"extract_archives,omitempty"`
+
+	Private bool `json:"private,omitempty"`
+}
+
+func (p *DownloadPreset) Validate() error {
+	if p.SelectionPreset != "" && p.Rules != nil {
+		return errors.New("use either selection_preset or rules, not both")
+	}
+	if p.Rules != nil {
+		if err := p.Rules.Validate(); err != nil {
+			return fmt.Errorf("invalid rules: %w", err)
+		}
+	}
+	if p.MaxDownloadSpeed < 0 || p.MaxUploadSpeed < 0 {
+		return errors.New("speed cannot be negative")
+	}
+	if p.SeedRatio < 0 || p.SeedTime < 0 {
+		return errors.New("seeding goal cannot be negative")
+	}
+	if err := postprocess.ValidateActions(p.OnComplete); err != nil {
+		return fmt.Errorf("invalid on_complete: %w", err)
+	}
+	return nil
+}
+
+// DownloadPreset retorna o preset de download salvo com o nome dado.
+func (cm *ConfigManager) DownloadPreset(name string) (DownloadPreset, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	preset, ok := cm.config.DownloadPresets[name]
+	return preset, ok
+}
+
+// SetDownloadPreset cria ou substitui um preset de download.
+func (cm *ConfigManager) SetDownloadPreset(name string, preset DownloadPreset) error {
+	if name == "" {
+		return fmt.Errorf("preset name is required")
+	}
+	if err := preset.Validate(); err != nil {
+		return err
+	}
+	if preset.SelectionPreset != "" {
+		if _, ok := cm.SelectionPreset(preset.SelectionPreset); !ok {
+			return fmt.Errorf("unknown selection preset: %s", preset.SelectionPreset)
+		}
+	}
+
+	cm.mu.Lock()
+	presets := make(map[string]DownloadPreset, len(cm.config.DownloadPresets)+1)
+	for k, v := range cm.config.DownloadPresets {
+		presets[k] = v
+	}
+	presets[name] = preset
+	cm.config.DownloadPresets = presets
+	cm.mu.Unlock()
+
+	return cm.Save()
+}
+
+// DeleteDownloadPreset remove um preset de download.
+func (cm *ConfigManager) DeleteDownloadPreset(name string) error {
+	cm.mu.Lock()
+	if _, ok := cm.config.DownloadPresets[name]; !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("download preset not found: %s", name)
+	}
+	presets := make(map[string]DownloadPreset, len(cm.config.DownloadPresets))
+	for k, v := range cm.config.DownloadPresets {
+		if k != name {
+			presets[k] = v
+		}
+	}
+	cm.config.DownloadPresets = presets
+	cm.mu.Unlock()
+
+	return cm.Save()
+}
+
+// PresetInUseError é retornado ao remover um preset de seleção que presets
+// de download ainda usam.
+type PresetInUseError struct {
+	Preset string
+	UsedBy []string
+}
+
+func (e *PresetInUseError) Error() string {
+	return fmt.Sprintf("selection preset %s is used by download presets: %s", e.Preset, strings.Join(e.UsedBy, ", "))
+}
+
+// downloadPresetsUsing lista, ordenados, os presets de download que usam o
+// preset de seleção name.
+func downloadPresetsUsing(cfg *AppConfig, name string) []string {
+	var names []string
+	for presetName, preset := range cfg.DownloadPresets {
+		if preset.SelectionPreset == name {
+			names = append(names, presetName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
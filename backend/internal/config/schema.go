@@ -0,0 +1,403 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"nebula/backend/internal/postprocess"
+)
+
+// FieldSchema descreve um campo de AppConfig aceito por Patch. Tipo e valor
+// padrão vêm de AppConfig e DefaultConfig.
+type FieldSchema struct {
+	Key             string      `json:"key"`
+	Type            string      `json:"type"`
+	Description     string      `json:"description,omitempty"`
+	Default         interface{} `json:"default"`
+	Minimum         *int64      `json:"minimum,omitempty"`
+	Maximum         *int64      `json:"maximum,omitempty"`
+	Enum            []string    `json:"enum,omitempty"`
+	Unit            string      `json:"unit,omitempty"`
+	RestartRequired bool        `json:"restart_required,omitempty"`
+	// NotApplied marca campos guardados mas que o backend ainda não usa
+	NotApplied bool `json:"not_applied,omitempty"`
+}
+
+// FieldError é um campo rejeitado por Patch.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reúne todos os campos rejeitados por Patch.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// fieldRule são as regras de um campo além do tipo. check recebe a
+// configuração já alterada, para regras que dependem de outros campos.
+type fieldRule struct {
+	description string
+	min, max    *int64
+	enum        []string
+	unit        string
+	restart     bool
+	notApplied  bool
+	check       func(cfg *AppConfig) error
+}
+
+func limit(v int64) *int64 { return &v }
+
+// maxSpeed é o maior limite em KB/s que ainda cabe em int64 como bytes/s.
+const maxSpeed = math.MaxInt64 / 1024
+
+var fieldRules = map[string]fieldRule{
+	"max_download_speed": {description: "Limite global de download (0 = sem limite)", min: limit(0), max: limit(maxSpeed), unit: "KB/s"},
+	"max_upload_speed":   {description: "Limite global de upload (0 = sem limite)", min: limit(0), max: limit(maxSpeed), unit: "KB/s"},
+	"theme":              {description: "Tema da interface", enum: []string{"auto", "light", "dark"}},
+	"compact":            {description: "Interface compacta"},
+	"notifications":      {description: "Notificações do sistema"},
+	"default_download_dir": {description: "Diretório padrão dos downloads", check: func(cfg *AppConfig) error {
+		if !filepath.IsAbs(cfg.DefaultDownloadDir) {
+			return fmt.Errorf("must be an absolute path")
+		}
+		return nil
+	}},
+	"proxy_enabled":           {description: "Usa o proxy configurado", check: checkProxy, notApplied: true},
+	"proxy_type":              {description: "Protocolo do proxy", enum: []string{"http", "https", "socks5"}, notApplied: true},
+	"proxy_address":           {description: "Host do proxy", check: checkProxy, notApplied: true},
+	"proxy_port":              {description: "Porta do proxy (0 = não definida)", min: limit(0), max: limit(65535), check: checkProxy, notApplied: true},
+	"max_connections":         {description: "Máximo de conexões (0 = padrão)", min: limit(0), max: limit(10000), notApplied: true},
+	"request_timeout":         {description: "Timeout das requisições", min: limit(1), max: limit(3600), unit: "s", notApplied: true},
+	"storage_backend":         {description: "Backend de armazenamento dos dados", enum: []string{"file", "mmap", "memory"}, restart: true},
+	"persistence_backend":     {description: "Onde ficam downloads, histórico e favoritos", enum: []string{"json", "sqlite"}, restart: true},
+	"preallocate":             {description: "Pré-aloca os arquivos selecionados (somente backend de arquivos)"},
+	"disk_reserve":            {description: "Espaço mantido livre ao iniciar um download", min: limit(0), unit: "bytes"},
+	"low_space_policy":        {description: "O que fazer sem espaço: recusar ou aguardar", enum: []string{"refuse", "queue"}},
+	"low_space_threshold":     {description: "Abaixo deste espaço livre os downloads são pausados (0 desativa)", min: limit(0), unit: "bytes"},
+	"auto_extract":            {description: "Extrai zip/tar após a conclusão"},
+	"extract_delete_archives": {description: "Remove os arquivos compactados após extrair"},
+	"on_complete": {description: "Ações após todo download concluído", check: func(cfg *AppConfig) error {
+		return postprocess.ValidateActions(cfg.OnComplete)
+	}},
+	"selection_presets": {description: "Presets de seleção por nome", check: func(cfg *AppConfig) error {
+		for name, rules := range cfg.SelectionPresets {
+			if name == "" {
+				return fmt.Errorf("preset name is required")
+			}
+			if err := rules.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}},
+	"download_presets": {description: "Presets de download por nome", check: func(cfg *AppConfig) error {
+		for name, preset := range cfg.DownloadPresets {
+			if name == "" {
+				return fmt.Errorf("preset name is required")
+			}
+			if err := preset.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if _, ok := cfg.SelectionPresets[preset.SelectionPreset]; preset.SelectionPreset != "" && !ok {
+				return fmt.Errorf("%s: unknown selection preset: %s", name, preset.SelectionPreset)
+			}
+		}
+		return nil
+	}},
+	"history_max_entries":  {description: "Máximo de entradas no histórico (0 = sem limite)", min: limit(0)},
+	"history_max_age_days": {description: "Idade máxima do último acesso (0 = sem limite)", min: limit(0), unit: "dias"},
+	"disable_history":      {description: "Trata todo download como privado"},
+	"log_level":            {description: "Nível mínimo do log", enum: []string{"debug", "info", "warn", "error"}},
+	"rate_limit":           {description: "Requisições por segundo aceitas pela API", min: limit(1), unit: "req/s"},
+	"rate_limit_burst":     {description: "Rajada de requisições aceita pela API", min: limit(1)},
+	"ip_rate_limit":        {description: "Requisições por segundo aceitas de cada IP", min: limit(1), unit: "req/s"},
+	"ip_rate_limit_burst":  {description: "Rajada de requisições aceita de cada IP", min: limit(1)},
+}
+
+func checkProxy(cfg *AppConfig) error {
+	if cfg.ProxyEnabled && (cfg.ProxyAddress == "" || cfg.ProxyPort == 0) {
+		return fmt.Errorf("proxy_address and proxy_port are required when the proxy is enabled")
+	}
+	return nil
+}
+
+// configFields indexa os campos de AppConfig pela tag json.
+var configFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(AppConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if key != "" && key != "-" {
+			fields[key] = i
+		}
+	}
+	return fields
+}()
+
+// Schema descreve todos os campos de AppConfig, ordenados pela chave.
+func Schema() []FieldSchema {
+	defaults := reflect.ValueOf(DefaultConfig()).Elem()
+
+	schema := make([]FieldSchema, 0, len(configFields))
+	for key, i := range configFields {
+		rule := fieldRules[key]
+		schema = append(schema, FieldSchema{
+			Key:             key,
+			Type:            jsonType(defaults.Field(i).Type()),
+			Description:     rule.description,
+			Default:         defaults.Field(i).Interface(),
+			Minimum:         rule.min,
+			Maximum:         rule.max,
+			Enum:            rule.enum,
+			Unit:            rule.unit,
+			RestartRequired: rule.restart,
+			NotApplied:      rule.notApplied,
+		})
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Key < schema[j].Key })
+	return schema
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Validate confere todos os campos de cfg com as regras de Patch.
+func Validate(cfg *AppConfig) error {
+	keys := make([]string, 0, len(configFields))
+	for key := range configFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	v := reflect.ValueOf(cfg).Elem()
+	var errs ValidationError
+	for _, key := range keys {
+		rule := fieldRules[key]
+		if msg := checkRange(rule, v.Field(configFields[key])); msg != "" {
+			errs = append(errs, FieldError{Field: key, Message: msg})
+			continue
+		}
+		if rule.check != nil {
+			if err := rule.check(cfg); err != nil {
+				errs = append(errs, FieldError{Field: key, Message: err.Error()})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// RestartRequired filtra de keys os campos que só valem ao reiniciar.
+func RestartRequired(keys []string) []string {
+	restart := []string{}
+	for _, key := range keys {
+		if fieldRules[key].restart {
+			restart = append(restart, key)
+		}
+	}
+	return restart
+}
+
+// NotApplied filtra de keys os campos que são guardados mas ainda não têm
+// efeito.
+func NotApplied(keys []string) []string {
+	ignored := []string{}
+	for _, key := range keys {
+		if fieldRules[key].notApplied {
+			ignored = append(ignored, key)
+		}
+	}
+	return ignored
+}
+
+// Patch altera os campos presentes em patch (chaves json de AppConfig). null
+// volta o campo ao padrão. Se algum campo for inválido nada é alterado e o
+// erro é um ValidationError com todos eles. Retorna as chaves cujo valor
+// mudou.
+func (cm *ConfigManager) Patch(patch map[string]json.RawMessage) ([]string, error) {
+	cm.mu.Lock()
+
+	current := reflect.ValueOf(cm.config).Elem()
+	next := *cm.config
+	nextValue := reflect.ValueOf(&next).Elem()
+	defaults := reflect.ValueOf(DefaultConfig()).Elem()
+
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs ValidationError
+	var decoded []string
+	for _, key := range keys {
+		i, ok := configFields[key]
+		if !ok {
+			errs = append(errs, FieldError{Field: key, Message: "unknown field"})
+			continue
+		}
+		if _, ok := cm.overrides[i]; ok {
+			errs = append(errs, FieldError{Field: key, Message: "set by a command-line flag or environment variable"})
+			continue
+		}
+		field := nextValue.Field(i)
+		raw := bytes.TrimSpace(patch[key])
+		if bytes.Equal(raw, []byte("null")) {
+			field.Set(defaults.Field(i))
+			decoded = append(decoded, key)
+			continue
+		}
+
+		if msg := setField(key, field, raw); msg != "" {
+			errs = append(errs, FieldError{Field: key, Message: msg})
+			continue
+		}
+		decoded = append(decoded, key)
+	}
+
+	// Confere a configuração inteira: regras entre campos (proxy, presets)
+	// podem falhar num campo que não está no patch
+	if err := Validate(&next); err != nil {
+		reported := make(map[string]bool, len(errs))
+		for _, e := range errs {
+			reported[e.Field] = true
+		}
+		for _, e := range err.(ValidationError) {
+			if !reported[e.Field] {
+				errs = append(errs, e)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		cm.mu.Unlock()
+		return nil, errs
+	}
+
+	changed := make([]string, 0, len(decoded))
+	for _, key := range decoded {
+		i := configFields[key]
+		if !reflect.DeepEqual(current.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	cm.config = &next
+	cm.mu.Unlock()
+
+	if len(changed) == 0 {
+		return changed, nil
+	}
+	return changed, cm.Save()
+}
+
+// setField decodifica raw em field e confere tipo e limites. Retorna a
+// mensagem de erro, ou "".
+func setField(key string, field reflect.Value, raw []byte) string {
+	// Decodifica num valor novo: mapas e slices são substituídos, não
+	// mesclados com o valor atual
+	value := reflect.New(field.Type())
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return "must be " + article(jsonType(field.Type()))
+	}
+	field.Set(value.Elem())
+	return checkRange(fieldRules[key], field)
+}
+
+// Override fixa o valor efetivo de um campo, como o de uma flag de linha de
+// comando: Get passa a retorná-lo, o arquivo continua sendo gravado sem ele
+// e Patch recusa alterar o campo. Não avisa os inscritos; é feito para a
+// inicialização.
+func (cm *ConfigManager) Override(key string, value interface{}) error {
+	i, ok := configFields[key]
+	if !ok {
+		return fmt.Errorf("unknown config field: %s", key)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	cfg := cm.Get()
+	field := reflect.ValueOf(cfg).Elem().Field(i)
+	if msg := setField(key, field, raw); msg != "" {
+		return ValidationError{{Field: key, Message: msg}}
+	}
+	if check := fieldRules[key].check; check != nil {
+		if err := check(cfg); err != nil {
+			return ValidationError{{Field: key, Message: err.Error()}}
+		}
+	}
+
+	cm.saveMu.Lock()
+	defer cm.saveMu.Unlock()
+
+	cm.mu.Lock()
+	if cm.overrides == nil {
+		cm.overrides = make(map[int]reflect.Value)
+	}
+	cm.overrides[i] = reflect.ValueOf(field.Interface())
+	cm.mu.Unlock()
+
+	cm.applied = cm.Get()
+	return nil
+}
+
+func checkRange(rule fieldRule, field reflect.Value) string {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v := field.Int()
+		if rule.min != nil && v < *rule.min {
+			return fmt.Sprintf("must be at least %d", *rule.min)
+		}
+		if rule.max != nil && v > *rule.max {
+			return fmt.Sprintf("must be at most %d", *rule.max)
+		}
+	case reflect.String:
+		if len(rule.enum) == 0 {
+			return ""
+		}
+		for _, allowed := range rule.enum {
+			if field.String() == allowed {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(rule.enum, ", ")
+	}
+	return ""
+}
+
+func article(jsonType string) string {
+	if jsonType == "integer" || jsonType == "array" || jsonType == "object" {
+		return "an " + jsonType
+	}
+	return "a " + jsonType
+}
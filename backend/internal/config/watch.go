@@ -0,0 +1,178 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"nebula/backend/internal/logger"
+)
+
+// WatchInterval é o intervalo entre as verificações do arquivo de
+// configuração feitas por Watch.
+const WatchInterval = 2 * time.Second
+
+// Origens de uma Change
+const (
+	SourceAPI  = "api"
+	SourceFile = "file"
+)
+
+// Change é uma alteração publicada aos inscritos. Old e New não devem ser
+// modificados.
+type Change struct {
+	Old     *AppConfig
+	New     *AppConfig
+	Changed []string
+	Source  string
+}
+
+// fileState identifica o conteúdo do arquivo, para que Watch ignore as
+// gravações feitas pelo próprio ConfigManager.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+}
+
+func readFileState(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size(), sum: sha256.Sum256(data)}
+}
+
+// Subscribe registra fn para cada alteração aplicada, pela API ou pelo
+// arquivo. fn é chamada em ordem, depois que a alteração já vale, e não deve
+// alterar a configuração. A função retornada cancela a inscrição.
+func (cm *ConfigManager) Subscribe(fn func(Change)) func() {
+	cm.subMu.Lock()
+	defer cm.subMu.Unlock()
+
+	if cm.subscribers == nil {
+		cm.subscribers = make(map[int]func(Change))
+	}
+	id := cm.nextSub
+	cm.nextSub++
+	cm.subscribers[id] = fn
+
+	return func() {
+		cm.subMu.Lock()
+		defer cm.subMu.Unlock()
+		delete(cm.subscribers, id)
+	}
+}
+
+// publish avisa os inscritos do que mudou desde a última publicação. Deve
+// ser chamada com saveMu.
+func (cm *ConfigManager) publish(config *AppConfig, source string) {
+	old := cm.applied
+	changed := changedKeys(old, config)
+	cm.applied = config
+	if len(changed) == 0 {
+		return
+	}
+
+	cm.subMu.Lock()
+	ids := make([]int, 0, len(cm.subscribers))
+	for id := range cm.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subscribers := make([]func(Change), len(ids))
+	for i, id := range ids {
+		subscribers[i] = cm.subscribers[id]
+	}
+	cm.subMu.Unlock()
+
+	change := Change{Old: old, New: config, Changed: changed, Source: source}
+	for _, fn := range subscribers {
+		fn(change)
+	}
+}
+
+// changedKeys lista, ordenadas, as chaves json com valores diferentes.
+func changedKeys(old, config *AppConfig) []string {
+	if old == nil {
+		old = &AppConfig{}
+	}
+	a := reflect.ValueOf(old).Elem()
+	b := reflect.ValueOf(config).Elem()
+
+	var changed []string
+	for key, i := range configFields {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Watch verifica o arquivo de configuração a cada WatchInterval até ctx ser
+// cancelado. Alterações externas válidas substituem a configuração inteira
+// de uma vez e são publicadas com SourceFile; as inválidas são registradas
+// no log e ignoradas até o arquivo mudar de novo.
+func (cm *ConfigManager) Watch(ctx context.Context) {
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := cm.reload(); err != nil {
+			logger.Warn("config file %s not applied: %v", cm.path, err)
+		}
+	}
+}
+
+func (cm *ConfigManager) reload() error {
+	cm.saveMu.Lock()
+	defer cm.saveMu.Unlock()
+
+	info, err := os.Stat(cm.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.ModTime().Equal(cm.file.modTime) && info.Size() == cm.file.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(cm.path)
+	if err != nil {
+		return err
+	}
+	state := fileState{modTime: info.ModTime(), size: info.Size(), sum: sha256.Sum256(data)}
+	unchanged := state.sum == cm.file.sum
+	cm.file = state
+	if unchanged {
+		return nil
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	cm.config = config
+	cm.mu.Unlock()
+
+	logger.Info("config reloaded from %s", cm.path)
+	cm.publish(cm.Get(), SourceFile)
+	return nil
+}
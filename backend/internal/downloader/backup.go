@@ -0,0 +1,223 @@
+package downloader
+
+import (
+	"sort"
+)
+
+// Snapshot é a cópia dos downloads, do histórico e dos favoritos incluída em
+// um backup.
+type Snapshot struct {
+	Downloads []*DownloadRecord
+	History   []*HistoryRecord
+	Favorites []*FavoriteRecord
+}
+
+// RestoreCount resume o que Restore fez com uma coleção.
+type RestoreCount struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Conflicts int `json:"conflicts"`
+	Removed   int `json:"removed"`
+}
+
+type RestoreResult struct {
+	Downloads RestoreCount `json:"downloads"`
+	History   RestoreCount `json:"history"`
+	Favorites RestoreCount `json:"favorites"`
+}
+
+// Snapshot copia os registros atuais. Downloads privados concluídos, que não
+// são gravados em disco, ficam de fora.
+func (pm *PersistenceManager) Snapshot() *Snapshot {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	s := &Snapshot{
+		Downloads: make([]*DownloadRecord, 0, len(pm.downloads)),
+		History:   make([]*HistoryRecord, 0, len(pm.history)),
+		Favorites: make([]*FavoriteRecord, 0, len(pm.favorites)),
+	}
+	for _, r := range pm.downloads {
+		if r.Private && r.Status == "completed" {
+			continue
+		}
+		copy := *r
+		s.Downloads = append(s.Downloads, &copy)
+	}
+	sort.Slice(s.Downloads, func(i, j int) bool {
+		return s.Downloads[i].CreatedAt.Before(s.Downloads[j].CreatedAt)
+	})
+	for _, r := range pm.history {
+		copy := *r
+		s.History = append(s.History, &copy)
+	}
+	sort.Slice(s.History, func(i, j int) bool { return s.History[i].ID < s.History[j].ID })
+	for _, r := range pm.favorites {
+		copy := *r
+		copy.Tags = append([]string{}, r.Tags...)
+		s.Favorites = append(s.Favorites, &copy)
+	}
+	sort.Slice(s.Favorites, func(i, j int) bool { return s.Favorites[i].ID < s.Favorites[j].ID })
+	return s
+}
+
+// Restore grava os registros de um backup. Com replace os registros atuais
+// são descartados e os do backup mantêm seus ids. Sem replace, downloads
+// ainda inexistentes são acrescentados e histórico e favoritos são juntados
+// como em ImportHistory e ImportFavorites.
+func (pm *PersistenceManager) Restore(s *Snapshot, replace bool) (*RestoreResult, error) {
+	data := &StoreData{
+		Downloads: make(map[string]*DownloadRecord, len(s.Downloads)),
+		History:   s.History,
+		Favorites: s.Favorites,
+	}
+	for _, r := range s.Downloads {
+		if r.ID == "" || r.Private && r.Status == "completed" {
+			continue
+		}
+		data.Downloads[r.ID] = r
+	}
+	migrateData(data)
+
+	if replace {
+		return pm.replaceAll(data)
+	}
+
+	result := &RestoreResult{}
+	if err := pm.mergeDownloads(data.Downloads, &result.Downloads); err != nil {
+		return result, err
+	}
+	history, err := pm.ImportHistory(data.History, false)
+	if err != nil {
+		return result, err
+	}
+	result.History = RestoreCount{Added: history.Added, Updated: history.Updated, Unchanged: history.Unchanged, Conflicts: history.Conflicts}
+	favorites, err := pm.ImportFavorites(data.Favorites, false)
+	if err != nil {
+		return result, err
+	}
+	result.Favorites = RestoreCount{Added: favorites.Added, Updated: favorites.Updated, Unchanged: favorites.Unchanged, Conflicts: favorites.Conflicts}
+	return result, nil
+}
+
+// mergeDownloads acrescenta os downloads cujo id e info hash ainda não
+// existem.
+func (pm *PersistenceManager) mergeDownloads(records map[string]*DownloadRecord, count *RestoreCount) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	known := make(map[string]bool, len(pm.downloads))
+	for _, r := range pm.downloads {
+		known[r.InfoHash] = true
+	}
+	for id, r := range records {
+		if _, exists := pm.downloads[id]; exists || known[r.InfoHash] {
+			count.Unchanged++
+			continue
+		}
+		pm.downloads[id] = r
+		known[r.InfoHash] = true
+		count.Added++
+		if err := pm.store.PutDownload(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pm *PersistenceManager) replaceAll(data *StoreData) (*RestoreResult, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	result := &RestoreResult{
+		Downloads: RestoreCount{Added: len(data.Downloads), Removed: len(pm.downloads)},
+		History:   RestoreCount{Added: len(data.History), Removed: len(pm.history)},
+		Favorites: RestoreCount{Added: len(data.Favorites), Removed: len(pm.favorites)},
+	}
+
+	var downloadIDs []string
+	for id := range pm.downloads {
+		if _, kept := data.Downloads[id]; !kept {
+			downloadIDs = append(downloadIDs, id)
+		}
+	}
+	if err := pm.store.DeleteDownloads(downloadIDs...); err != nil {
+		return result, err
+	}
+	pm.downloads = data.Downloads
+	for _, r := range pm.downloads {
+		if err := pm.store.PutDownload(r); err != nil {
+			return result, err
+		}
+	}
+
+	// Ids repetidos ou ausentes no backup recebem novos ids
+	assignHistoryIDs(data.History)
+	var historyIDs []int
+	for _, r := range pm.history {
+		historyIDs = append(historyIDs, r.ID)
+	}
+	if err := pm.store.DeleteHistory(historyIDs...); err != nil {
+		return result, err
+	}
+	pm.history = data.History
+	if len(pm.history) > 0 {
+		if err := pm.store.PutHistory(pm.history...); err != nil {
+			return result, err
+		}
+	}
+	if err := pm.store.DeleteHistory(pm.pruneHistory()...); err != nil {
+		return result, err
+	}
+
+	assignFavoriteIDs(data.Favorites)
+	var favoriteIDs []int
+	for _, r := range pm.favorites {
+		favoriteIDs = append(favoriteIDs, r.ID)
+	}
+	if err := pm.store.DeleteFavorites(favoriteIDs...); err != nil {
+		return result, err
+	}
+	pm.favorites = data.Favorites
+	if len(pm.favorites) > 0 {
+		if err := pm.store.PutFavorites(pm.favorites...); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func assignHistoryIDs(records []*HistoryRecord) {
+	next := 1
+	for _, r := range records {
+		if r.ID >= next {
+			next = r.ID + 1
+		}
+	}
+	seen := make(map[int]bool, len(records))
+	for _, r := range records {
+		if r.ID <= 0 || seen[r.ID] {
+			r.ID = next
+			next++
+		}
+		seen[r.ID] = true
+	}
+}
+
+func assignFavoriteIDs(records []*FavoriteRecord) {
+	next := 1
+	for _, r := range records {
+		if r.ID >= next {
+			next = r.ID + 1
+		}
+	}
+	seen := make(map[int]bool, len(records))
+	for _, r := range records {
+		if r.ID <= 0 || seen[r.ID] {
+			r.ID = next
+			next++
+		}
+		seen[r.ID] = true
+	}
+}
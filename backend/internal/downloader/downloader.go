@@ -3,22 +3,57 @@ package downloader
 import (
 	"context"
 	"errors"
-	"strings"
 	"time"
 
 	"nebula/backend/internal/fileutil"
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/selection"
 )
 
 const (
-	MetadataTimeout  = 30 * time.Second
-	ProgressInterval = 2 * time.Second
+	MetadataTimeout        = 30 * time.Second
+	ProgressInterval       = 2 * time.Second
+	DiskSpaceRetryInterval = 30 * time.Second
 )
 
+const (
+	StorageFile = "file"
+	StorageMMap = "mmap"
+
+	AllocationSparse = "sparse"
+	AllocationFull   = "full"
+)
+
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+var (
+	// ErrAlreadyActive impede que o mesmo torrent seja adicionado duas vezes
+	// ao cliente; o segundo download derrubaria o primeiro ao terminar.
+	ErrAlreadyActive = errors.New("torrent is already being downloaded")
+	ErrNotActive     = errors.New("torrent is not being downloaded")
+)
+
+// ErrV2Only indica um magnet somente v2, que o motor de torrent ainda não
+// consegue baixar. Magnets híbridos são baixados pelo hash v1.
+var ErrV2Only = errors.New("BitTorrent v2-only magnets are not supported yet")
+
 type DownloadConfig struct {
 	MaxDownloadSpeed int64
 	MaxUploadSpeed   int64
 }
 
+// DownloadResult descreve um download concluído. Files contém os caminhos
+// dos arquivos selecionados relativos ao diretório de saída.
+type DownloadResult struct {
+	Name     string
+	InfoHash string
+	// Dir é o diretório em que os arquivos foram gravados; Files é
+	// relativo a ele
+	Dir       string
+	TotalSize int64
+	Files     []string
+}
+
 type FileMetadata struct {
 	Index    int               `json:"index"`
 	Path     string            `json:"path"`
@@ -35,6 +70,22 @@ func NewFileMetadata(index int, path string, size int64) *FileMetadata {
 	}
 }
 
+// ApplyRules filtra os arquivos de índices (todos, se vazio) pelas regras.
+func ApplyRules(files []FileMetadata, indices []int, rules *selection.Rules) []int {
+	wanted := make(map[int]bool, len(indices))
+	for _, idx := range indices {
+		wanted[idx] = true
+	}
+
+	candidates := make([]selection.File, 0, len(files))
+	for _, f := range files {
+		if len(indices) == 0 || wanted[f.Index] {
+			candidates = append(candidates, selection.File{Index: f.Index, Path: f.Path, Size: f.Size})
+		}
+	}
+	return rules.Apply(candidates)
+}
+
 type PauseManager struct {
 	paused chan bool
 }
@@ -86,17 +137,24 @@ type ProgressReporter interface {
 	OnProgress(id string, percentage float64, downloadSpeed float64, uploadSpeed float64)
 	OnLog(id string, message string)
 	SetMeta(name string, totalSize int64, peers int)
+	// OnEvent publica eventos que não são de progresso, como "extract".
+	OnEvent(id string, eventType string, data map[string]interface{})
 }
 
 func ValidateMagnetLink(link string) error {
-	if link == "" {
-		return errors.New("magnet link cannot be empty")
-	}
-	if !strings.HasPrefix(link, "magnet:?") {
-		return errors.New("invalid magnet link format")
+	_, err := magnet.Parse(link)
+	return err
+}
+
+// resolveMagnet converte link (magnet ou hash solto) no magnet canônico
+// entregue ao cliente de torrent.
+func resolveMagnet(link string) (string, error) {
+	m, err := magnet.Parse(link)
+	if err != nil {
+		return "", err
 	}
-	if !strings.Contains(link, "xt=urn:btih:") {
-		return errors.New("magnet link missing info hash")
+	if !m.HasV1() {
+		return "", ErrV2Only
 	}
-	return nil
+	return m.String(), nil
 }
@@ -7,6 +7,7 @@ import (
 type HistoryRecordDTO struct {
 	ID          int    `json:"id"`
 	MagnetLink  string `json:"magnet_link"`
+	InfoHash    string `json:"info_hash"`
 	TorrentName string `json:"torrent_name"`
 	FileCount   int    `json:"file_count"`
 	TotalSize   int64  `json:"total_size"`
@@ -16,11 +17,14 @@ type HistoryRecordDTO struct {
 type FavoriteRecordDTO struct {
 	ID          int      `json:"id"`
 	MagnetLink  string   `json:"magnet_link"`
+	InfoHash    string   `json:"info_hash"`
 	TorrentName string   `json:"torrent_name"`
 	Tags        []string `json:"tags"`
 	Notes       string   `json:"notes,omitempty"`
 	AddedAt     string   `json:"added_at"`
 	UpdatedAt   string   `json:"updated_at"`
+
+	Download *FavoriteDownload `json:"download,omitempty"`
 }
 
 func (h *HistoryRecord) ToDTO() *HistoryRecordDTO {
@@ -30,6 +34,7 @@ func (h *HistoryRecord) ToDTO() *HistoryRecordDTO {
 	return &HistoryRecordDTO{
 		ID:          h.ID,
 		MagnetLink:  h.MagnetLink,
+		InfoHash:    h.InfoHash,
 		TorrentName: h.TorrentName,
 		FileCount:   h.FileCount,
 		TotalSize:   h.TotalSize,
@@ -44,10 +49,12 @@ func (f *FavoriteRecord) ToDTO() *FavoriteRecordDTO {
 	return &FavoriteRecordDTO{
 		ID:          f.ID,
 		MagnetLink:  f.MagnetLink,
+		InfoHash:    f.InfoHash,
 		TorrentName: f.TorrentName,
 		Tags:        f.Tags,
 		Notes:       f.Notes,
 		AddedAt:     f.AddedAt.Format(time.RFC3339),
 		UpdatedAt:   f.UpdatedAt.Format(time.RFC3339),
+		Download:    f.Download,
 	}
 }
@@ -0,0 +1,604 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"nebula/backend/internal/magnet"
+)
+
+// Formatos de importação e exportação de favoritos e histórico
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatMagnet = "magnet"
+)
+
+// Ações informadas para cada entrada importada
+const (
+	ImportAdded     = "added"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportInvalid   = "invalid"
+	// ImportConflict: a entrada já existia com valores diferentes que a
+	// importação não adotou; os demais campos foram mesclados normalmente.
+	ImportConflict = "conflict"
+)
+
+const defaultFavoriteName = "Download Favorito"
+
+var (
+	favoriteCSVHeader = []string{"info_hash", "name", "magnet_link", "tags", "notes", "added_at", "updated_at"}
+	historyCSVHeader  = []string{"info_hash", "name", "magnet_link", "file_count", "total_size", "accessed_at"}
+)
+
+// ImportItem descreve o que a importação fez (ou faria, em dry-run) com uma
+// entrada.
+type ImportItem struct {
+	Input    string `json:"input,omitempty"`
+	InfoHash string `json:"info_hash,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Action   string `json:"action"`
+	// Conflicts lista os campos em conflito quando Action é ImportConflict
+	Conflicts []string `json:"conflicts,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun    bool         `json:"dry_run"`
+	Added     int          `json:"added"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Invalid   int          `json:"invalid"`
+	Conflicts int          `json:"conflicts"`
+	Items     []ImportItem `json:"items"`
+}
+
+func (r *ImportResult) add(item ImportItem) {
+	switch item.Action {
+	case ImportAdded:
+		r.Added++
+	case ImportUpdated:
+		r.Updated++
+	case ImportUnchanged:
+		r.Unchanged++
+	case ImportInvalid:
+		r.Invalid++
+	case ImportConflict:
+		r.Conflicts++
+	}
+	r.Items = append(r.Items, item)
+}
+
+func ValidateExchangeFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatCSV, FormatMagnet:
+		return nil
+	default:
+		return fmt.Errorf("format must be json, csv or magnet")
+	}
+}
+
+// --- Exportação ---
+
+func EncodeFavorites(w io.Writer, format string, records []*FavoriteRecord) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(favoriteCSVHeader)
+		for _, r := range records {
+			cw.Write([]string{
+				r.InfoHash, r.TorrentName, r.MagnetLink, strings.Join(r.Tags, ";"), r.Notes,
+				formatTime(r.AddedAt), formatTime(r.UpdatedAt),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatMagnet:
+		for _, r := range records {
+			if _, err := fmt.Fprintln(w, r.MagnetLink); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return ValidateExchangeFormat(format)
+	}
+}
+
+func EncodeHistory(w io.Writer, format string, records []*HistoryRecord) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(historyCSVHeader)
+		for _, r := range records {
+			cw.Write([]string{
+				r.InfoHash, r.TorrentName, r.MagnetLink, strconv.Itoa(r.FileCount),
+				strconv.FormatInt(r.TotalSize, 10), formatTime(r.AccessedAt),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatMagnet:
+		for _, r := range records {
+			if _, err := fmt.Fprintln(w, r.MagnetLink); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return ValidateExchangeFormat(format)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// --- Importação ---
+
+// DecodeFavorites lê favoritos no formato dado. Entradas sem magnet ou info
+// hash válido voltam em invalid e não interrompem a leitura.
+func DecodeFavorites(data []byte, format string) (records []*FavoriteRecord, invalid []ImportItem, err error) {
+	switch format {
+	case FormatJSON:
+		var raw []*FavoriteRecord
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, nil, fmt.Errorf("invalid json: %w", err)
+		}
+		for _, r := range raw {
+			if r == nil {
+				continue
+			}
+			if item, ok := canonicalize(&r.MagnetLink, r.InfoHash, r.TorrentName); !ok {
+				invalid = append(invalid, item)
+				continue
+			}
+			records = append(records, r)
+		}
+	case FormatCSV:
+		rows, err := readCSV(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			r := &FavoriteRecord{
+				MagnetLink:  row["magnet_link"],
+				TorrentName: row["name"],
+				Notes:       row["notes"],
+				AddedAt:     parseTime(row["added_at"]),
+				UpdatedAt:   parseTime(row["updated_at"]),
+			}
+			if tags := row["tags"]; tags != "" {
+				r.Tags = strings.Split(tags, ";")
+			}
+			if item, ok := canonicalize(&r.MagnetLink, row["info_hash"], r.TorrentName); !ok {
+				invalid = append(invalid, item)
+				continue
+			}
+			records = append(records, r)
+		}
+	case FormatMagnet:
+		found, bad := magnet.Extract(string(data))
+		for _, f := range found {
+			records = append(records, &FavoriteRecord{
+				MagnetLink:  f.Magnet.String(),
+				TorrentName: f.Magnet.DisplayName,
+			})
+		}
+		for _, input := range bad {
+			invalid = append(invalid, ImportItem{Input: input, Action: ImportInvalid, Error: "invalid magnet link"})
+		}
+	default:
+		return nil, nil, ValidateExchangeFormat(format)
+	}
+	return records, invalid, nil
+}
+
+// DecodeHistory lê entradas de histórico no formato dado.
+func DecodeHistory(data []byte, format string) (records []*HistoryRecord, invalid []ImportItem, err error) {
+	switch format {
+	case FormatJSON:
+		var raw []*HistoryRecord
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, nil, fmt.Errorf("invalid json: %w", err)
+		}
+		for _, r := range raw {
+			if r == nil {
+				continue
+			}
+			if item, ok := canonicalize(&r.MagnetLink, r.InfoHash, r.TorrentName); !ok {
+				invalid = append(invalid, item)
+				continue
+			}
+			records = append(records, r)
+		}
+	case FormatCSV:
+		rows, err := readCSV(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			r := &HistoryRecord{
+				MagnetLink:  row["magnet_link"],
+				TorrentName: row["name"],
+				AccessedAt:  parseTime(row["accessed_at"]),
+			}
+			r.FileCount, _ = strconv.Atoi(row["file_count"])
+			r.TotalSize, _ = strconv.ParseInt(row["total_size"], 10, 64)
+			if item, ok := canonicalize(&r.MagnetLink, row["info_hash"], r.TorrentName); !ok {
+				invalid = append(invalid, item)
+				continue
+			}
+			records = append(records, r)
+		}
+	case FormatMagnet:
+		found, bad := magnet.Extract(string(data))
+		for _, f := range found {
+			records = append(records, &HistoryRecord{
+				MagnetLink:  f.Magnet.String(),
+				TorrentName: f.Magnet.DisplayName,
+			})
+		}
+		for _, input := range bad {
+			invalid = append(invalid, ImportItem{Input: input, Action: ImportInvalid, Error: "invalid magnet link"})
+		}
+	default:
+		return nil, nil, ValidateExchangeFormat(format)
+	}
+	return records, invalid, nil
+}
+
+// canonicalize troca link pelo magnet normalizado, usando o info hash quando
+// não há magnet.
+func canonicalize(link *string, infoHash, name string) (ImportItem, bool) {
+	input := strings.TrimSpace(*link)
+	if input == "" {
+		input = strings.TrimSpace(infoHash)
+	}
+	normalized, err := magnet.Normalize(input)
+	if err != nil {
+		return ImportItem{Input: input, Name: name, Action: ImportInvalid, Error: err.Error()}, false
+	}
+	*link = normalized
+	return ImportItem{}, true
+}
+
+// readCSV lê um CSV com cabeçalho e retorna cada linha indexada pelo nome da
+// coluna, para aceitar colunas em qualquer ordem.
+func readCSV(data []byte) ([]map[string]string, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		row := make(map[string]string, len(header))
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// ImportFavorites junta os favoritos importados aos existentes pelo info
+// hash: tags são unidas, notas acrescentadas e o download salvo só é usado
+// quando o favorito não tem um. Nome ou download diferentes do existente e
+// notas acrescentadas ao lado de outras voltam como ImportConflict. Com
+// dryRun nada é gravado.
+func (pm *PersistenceManager) ImportFavorites(records []*FavoriteRecord, dryRun bool) (*ImportResult, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	result := &ImportResult{DryRun: dryRun, Items: []ImportItem{}}
+	working := make(map[string]*FavoriteRecord, len(pm.favorites))
+	for _, r := range pm.favorites {
+		working[r.InfoHash] = r
+	}
+	// cloned guarda a cópia editável de cada favorito existente; owned marca
+	// os registros que já podem ser alterados (cópias e novos)
+	cloned := make(map[*FavoriteRecord]*FavoriteRecord)
+	owned := make(map[*FavoriteRecord]bool)
+	var added []*FavoriteRecord
+	now := time.Now()
+
+	for _, in := range records {
+		key := infoHashKey(in.MagnetLink)
+		item := ImportItem{InfoHash: key, Name: in.TorrentName}
+
+		existing := working[key]
+		if existing == nil {
+			r := &FavoriteRecord{
+				MagnetLink:  in.MagnetLink,
+				InfoHash:    key,
+				TorrentName: in.TorrentName,
+				Tags:        cleanTags(in.Tags),
+				Notes:       in.Notes,
+				AddedAt:     in.AddedAt,
+				UpdatedAt:   now,
+				Download:    in.Download,
+			}
+			if r.TorrentName == "" {
+				r.TorrentName = defaultFavoriteName
+			}
+			if r.AddedAt.IsZero() {
+				r.AddedAt = now
+			}
+			working[key] = r
+			owned[r] = true
+			added = append(added, r)
+			item.Action = ImportAdded
+			result.add(item)
+			continue
+		}
+
+		target := existing
+		if !owned[existing] {
+			clone := *existing
+			clone.Tags = append([]string{}, existing.Tags...)
+			cloned[existing] = &clone
+			owned[&clone] = true
+			working[key] = &clone
+			target = &clone
+		}
+		item.Name = target.TorrentName
+		changed, conflicts := mergeFavorite(target, in)
+		if changed {
+			target.UpdatedAt = now
+		}
+		item.Action = importAction(changed, conflicts)
+		item.Conflicts = conflicts
+		result.add(item)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	var changed []*FavoriteRecord
+	for i, r := range pm.favorites {
+		if clone, ok := cloned[r]; ok {
+			pm.favorites[i] = clone
+			changed = append(changed, clone)
+		}
+	}
+	newID := 1
+	for _, r := range pm.favorites {
+		if r.ID >= newID {
+			newID = r.ID + 1
+		}
+	}
+	for _, r := range added {
+		r.ID = newID
+		newID++
+		pm.favorites = append(pm.favorites, r)
+		changed = append(changed, r)
+	}
+
+	if len(changed) == 0 {
+		return result, nil
+	}
+	return result, pm.store.PutFavorites(changed...)
+}
+
+// importAction escolhe a ação de uma entrada que já existia.
+func importAction(changed bool, conflicts []string) string {
+	switch {
+	case len(conflicts) > 0:
+		return ImportConflict
+	case changed:
+		return ImportUpdated
+	default:
+		return ImportUnchanged
+	}
+}
+
+// mergeFavorite mescla src em dst e lista, pelas chaves json, os campos em
+// que os valores divergiam.
+func mergeFavorite(dst, src *FavoriteRecord) (bool, []string) {
+	changed := false
+	var conflicts []string
+
+	tags := mergeTags(dst.Tags, cleanTags(src.Tags))
+	if len(tags) != len(dst.Tags) {
+		dst.Tags = tags
+		changed = true
+	}
+	if src.Notes != "" && !strings.Contains(dst.Notes, src.Notes) {
+		if dst.Notes != "" {
+			dst.Notes += "\n"
+			conflicts = append(conflicts, "notes")
+		}
+		dst.Notes += src.Notes
+		changed = true
+	}
+	if src.TorrentName != "" && src.TorrentName != dst.TorrentName {
+		if dst.TorrentName == "" || dst.TorrentName == defaultFavoriteName {
+			dst.TorrentName = src.TorrentName
+			changed = true
+		} else {
+			conflicts = append(conflicts, "torrent_name")
+		}
+	}
+	if src.Download != nil {
+		if dst.Download == nil {
+			dst.Download = src.Download
+			changed = true
+		} else if !reflect.DeepEqual(dst.Download, src.Download) {
+			conflicts = append(conflicts, "download")
+		}
+	}
+	if !src.AddedAt.IsZero() && src.AddedAt.Before(dst.AddedAt) {
+		dst.AddedAt = src.AddedAt
+		changed = true
+	}
+	return changed, conflicts
+}
+
+// ImportHistory junta as entradas importadas ao histórico pelo info hash,
+// mantendo o acesso mais recente e completando nome, arquivos e tamanho.
+// Valores diferentes dos já gravados voltam como ImportConflict.
+func (pm *PersistenceManager) ImportHistory(records []*HistoryRecord, dryRun bool) (*ImportResult, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	result := &ImportResult{DryRun: dryRun, Items: []ImportItem{}}
+	working := make(map[string]*HistoryRecord, len(pm.history))
+	for _, r := range pm.history {
+		working[r.InfoHash] = r
+	}
+	cloned := make(map[*HistoryRecord]*HistoryRecord)
+	owned := make(map[*HistoryRecord]bool)
+	var added []*HistoryRecord
+	now := time.Now()
+
+	for _, in := range records {
+		key := infoHashKey(in.MagnetLink)
+		item := ImportItem{InfoHash: key, Name: in.TorrentName}
+
+		existing := working[key]
+		if existing == nil {
+			r := &HistoryRecord{
+				MagnetLink:  in.MagnetLink,
+				InfoHash:    key,
+				TorrentName: in.TorrentName,
+				FileCount:   in.FileCount,
+				TotalSize:   in.TotalSize,
+				AccessedAt:  in.AccessedAt,
+			}
+			if r.AccessedAt.IsZero() {
+				r.AccessedAt = now
+			}
+			working[key] = r
+			owned[r] = true
+			added = append(added, r)
+			item.Action = ImportAdded
+			result.add(item)
+			continue
+		}
+
+		target := existing
+		if !owned[existing] {
+			clone := *existing
+			cloned[existing] = &clone
+			owned[&clone] = true
+			working[key] = &clone
+			target = &clone
+		}
+		item.Name = target.TorrentName
+		changed, conflicts := mergeHistory(target, in)
+		item.Action = importAction(changed, conflicts)
+		item.Conflicts = conflicts
+		result.add(item)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	var changed []*HistoryRecord
+	for i, r := range pm.history {
+		if clone, ok := cloned[r]; ok {
+			pm.history[i] = clone
+			changed = append(changed, clone)
+		}
+	}
+	newID := 1
+	for _, r := range pm.history {
+		if r.ID >= newID {
+			newID = r.ID + 1
+		}
+	}
+	for _, r := range added {
+		r.ID = newID
+		newID++
+		pm.history = append(pm.history, r)
+		changed = append(changed, r)
+	}
+
+	if len(changed) == 0 {
+		return result, nil
+	}
+	if err := pm.store.PutHistory(changed...); err != nil {
+		return result, err
+	}
+	return result, pm.store.DeleteHistory(pm.pruneHistory()...)
+}
+
+func mergeHistory(dst, src *HistoryRecord) (bool, []string) {
+	changed := false
+	var conflicts []string
+	if src.AccessedAt.After(dst.AccessedAt) {
+		dst.AccessedAt = src.AccessedAt
+		changed = true
+	}
+	if src.TorrentName != "" && src.TorrentName != dst.TorrentName {
+		if dst.TorrentName == "" {
+			dst.TorrentName = src.TorrentName
+			changed = true
+		} else {
+			conflicts = append(conflicts, "torrent_name")
+		}
+	}
+	if src.FileCount > 0 && src.FileCount != dst.FileCount {
+		if dst.FileCount == 0 {
+			dst.FileCount = src.FileCount
+			changed = true
+		} else {
+			conflicts = append(conflicts, "file_count")
+		}
+	}
+	if src.TotalSize > 0 && src.TotalSize != dst.TotalSize {
+		if dst.TotalSize == 0 {
+			dst.TotalSize = src.TotalSize
+			changed = true
+		} else {
+			conflicts = append(conflicts, "total_size")
+		}
+	}
+	return changed, conflicts
+}
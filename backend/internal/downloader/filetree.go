@@ -0,0 +1,167 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"nebula/backend/internal/fileutil"
+)
+
+// FileTreeNode é um diretório ou arquivo da árvore do torrent. Diretórios
+// agregam tamanho, quantidade de arquivos e a distribuição por tipo dos
+// arquivos abaixo deles.
+type FileTreeNode struct {
+	Name      string                           `json:"name"`
+	Path      string                           `json:"path"`
+	IsDir     bool                             `json:"is_dir"`
+	Index     *int                             `json:"index,omitempty"`
+	FileType  fileutil.FileType                `json:"file_type,omitempty"`
+	Size      int64                            `json:"size"`
+	FileCount int                              `json:"file_count"`
+	Types     map[fileutil.FileType]*TypeStats `json:"types,omitempty"`
+
+	// Selected/SelectedCount só são preenchidos quando há uma seleção
+	Selected      *bool           `json:"selected,omitempty"`
+	SelectedCount int             `json:"selected_count,omitempty"`
+	Children      []*FileTreeNode `json:"children,omitempty"`
+}
+
+type TypeStats struct {
+	Count int   `json:"count"`
+	Size  int64 `json:"size"`
+}
+
+// BuildFileTree monta a árvore a partir da lista plana de arquivos. Se
+// selected não for nil, marca os arquivos selecionados e conta, por pasta,
+// quantos estão selecionados.
+func BuildFileTree(files []FileMetadata, selected []int) *FileTreeNode {
+	root := &FileTreeNode{IsDir: true, Types: make(map[fileutil.FileType]*TypeStats)}
+
+	var selectedSet map[int]bool
+	if selected != nil {
+		selectedSet = make(map[int]bool, len(selected))
+		for _, idx := range selected {
+			selectedSet[idx] = true
+		}
+	}
+
+	for _, f := range files {
+		parts := strings.Split(f.Path, "/")
+		node := root
+		ancestors := []*FileTreeNode{root}
+		for depth, part := range parts[:len(parts)-1] {
+			node = node.child(part, strings.Join(parts[:depth+1], "/"))
+			ancestors = append(ancestors, node)
+		}
+
+		index := f.Index
+		leaf := &FileTreeNode{
+			Name:      parts[len(parts)-1],
+			Path:      f.Path,
+			Index:     &index,
+			FileType:  f.FileType,
+			Size:      f.Size,
+			FileCount: 1,
+		}
+		isSelected := selectedSet[f.Index]
+		if selectedSet != nil {
+			leaf.Selected = &isSelected
+		}
+		node.Children = append(node.Children, leaf)
+
+		for _, dir := range ancestors {
+			dir.Size += f.Size
+			dir.FileCount++
+			stats, ok := dir.Types[f.FileType]
+			if !ok {
+				stats = &TypeStats{}
+				dir.Types[f.FileType] = stats
+			}
+			stats.Count++
+			stats.Size += f.Size
+			if isSelected {
+				dir.SelectedCount++
+			}
+		}
+	}
+
+	root.sort()
+	return root
+}
+
+func (n *FileTreeNode) child(name, path string) *FileTreeNode {
+	for _, c := range n.Children {
+		if c.IsDir && c.Name == name {
+			return c
+		}
+	}
+	dir := &FileTreeNode{
+		Name:  name,
+		Path:  path,
+		IsDir: true,
+		Types: make(map[fileutil.FileType]*TypeStats),
+	}
+	n.Children = append(n.Children, dir)
+	return dir
+}
+
+// sort coloca pastas antes de arquivos, ambos em ordem alfabética.
+func (n *FileTreeNode) sort() {
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	for _, c := range n.Children {
+		if c.IsDir {
+			c.sort()
+		}
+	}
+}
+
+// FolderOp seleciona ou remove da seleção tudo abaixo de Path (uma pasta ou
+// um arquivo, no formato de FileMetadata.Path).
+type FolderOp struct {
+	Path   string `json:"path"`
+	Select bool   `json:"select"`
+}
+
+// ApplyFolderOps aplica as operações, em ordem, sobre a seleção atual e
+// retorna os índices resultantes em ordem crescente.
+func ApplyFolderOps(files []FileMetadata, current []int, ops []FolderOp) ([]int, error) {
+	selected := make(map[int]bool, len(current))
+	for _, idx := range current {
+		if idx < 0 || idx >= len(files) {
+			return nil, fmt.Errorf("invalid file index: %d (torrent has %d files)", idx, len(files))
+		}
+		selected[idx] = true
+	}
+
+	for _, op := range ops {
+		prefix := strings.Trim(op.Path, "/")
+		matched := false
+		for _, f := range files {
+			if prefix == "" || f.Path == prefix || strings.HasPrefix(f.Path, prefix+"/") {
+				matched = true
+				if op.Select {
+					selected[f.Index] = true
+				} else {
+					delete(selected, f.Index)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("path not found in torrent: %q", op.Path)
+		}
+	}
+
+	indices := make([]int, 0, len(selected))
+	for idx := range selected {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
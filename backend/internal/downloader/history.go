@@ -0,0 +1,159 @@
+package downloader
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// HistoryPruneInterval é o intervalo entre as aplicações da retenção feitas
+// por RunHistoryRetention.
+const HistoryPruneInterval = time.Hour
+
+// Ordenações aceitas por QueryHistory
+const (
+	HistorySortAccessed = "accessed_at"
+	HistorySortName     = "name"
+	HistorySortSize     = "size"
+)
+
+// HistoryQuery filtra, ordena e pagina o histórico. From e To limitam
+// AccessedAt (zero não limita); Limit 0 retorna tudo a partir de Offset.
+type HistoryQuery struct {
+	Text   string
+	From   time.Time
+	To     time.Time
+	Sort   string
+	Desc   bool
+	Offset int
+	Limit  int
+}
+
+// HistoryRetention limita o histórico pelo número de entradas e pela idade do
+// último acesso. Zero desativa cada limite.
+type HistoryRetention struct {
+	MaxEntries int
+	MaxAge     time.Duration
+}
+
+// QueryHistory retorna a página pedida e o total de entradas que atendem aos
+// filtros. Entradas além da idade máxima ficam de fora mesmo antes de
+// RunHistoryRetention removê-las.
+func (pm *PersistenceManager) QueryHistory(q HistoryQuery) ([]*HistoryRecord, int, error) {
+	pm.mu.RLock()
+	maxAge := pm.retention.MaxAge
+	pm.mu.RUnlock()
+
+	if maxAge > 0 {
+		if cutoff := time.Now().Add(-maxAge); q.From.Before(cutoff) {
+			q.From = cutoff
+		}
+	}
+	return pm.store.QueryHistory(q)
+}
+
+// DeleteHistory remove uma entrada. Retorna false se o id não existe.
+func (pm *PersistenceManager) DeleteHistory(id int) (bool, error) {
+	pm.mu.Lock()
+	for i, r := range pm.history {
+		if r.ID == id {
+			pm.history = append(pm.history[:i], pm.history[i+1:]...)
+			defer pm.unlockForWrite()()
+			return true, pm.store.DeleteHistory(id)
+		}
+	}
+	pm.mu.Unlock()
+	return false, nil
+}
+
+// ClearHistory remove as entradas acessadas antes de before (zero remove
+// todas) e retorna quantas foram removidas.
+func (pm *PersistenceManager) ClearHistory(before time.Time) (int, error) {
+	pm.mu.Lock()
+
+	kept := make([]*HistoryRecord, 0, len(pm.history))
+	var removed []int
+	for _, r := range pm.history {
+		if !before.IsZero() && !r.AccessedAt.Before(before) {
+			kept = append(kept, r)
+		} else {
+			removed = append(removed, r.ID)
+		}
+	}
+
+	if len(removed) == 0 {
+		pm.mu.Unlock()
+		return 0, nil
+	}
+	pm.history = kept
+	defer pm.unlockForWrite()()
+	return len(removed), pm.store.DeleteHistory(removed...)
+}
+
+// SetHistoryRetention define os limites do histórico e os aplica
+// imediatamente. Depois disso são aplicados a cada gravação do histórico.
+func (pm *PersistenceManager) SetHistoryRetention(r HistoryRetention) error {
+	pm.mu.Lock()
+	pm.retention = r
+	removed := pm.pruneHistory()
+	defer pm.unlockForWrite()()
+
+	return pm.store.DeleteHistory(removed...)
+}
+
+// RunHistoryRetention aplica a retenção a cada HistoryPruneInterval até ctx
+// ser cancelado, para que a idade máxima valha sem novas gravações.
+func (pm *PersistenceManager) RunHistoryRetention(ctx context.Context) {
+	ticker := time.NewTicker(HistoryPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pm.mu.Lock()
+		removed := pm.pruneHistory()
+		release := pm.unlockForWrite()
+		err := pm.store.DeleteHistory(removed...)
+		release()
+		if err != nil {
+			log.Printf("[Persistence] WARNING: failed to prune history: %v", err)
+		}
+	}
+}
+
+// pruneHistory descarta as entradas além da retenção, começando pelas de
+// acesso mais antigo, e retorna os ids removidos. Deve ser chamado com pm.mu
+// travado.
+func (pm *PersistenceManager) pruneHistory() []int {
+	r := pm.retention
+	var removed []int
+
+	if r.MaxAge > 0 {
+		cutoff := time.Now().Add(-r.MaxAge)
+		kept := make([]*HistoryRecord, 0, len(pm.history))
+		for _, h := range pm.history {
+			if h.AccessedAt.Before(cutoff) {
+				removed = append(removed, h.ID)
+			} else {
+				kept = append(kept, h)
+			}
+		}
+		pm.history = kept
+	}
+
+	if r.MaxEntries > 0 && len(pm.history) > r.MaxEntries {
+		sort.SliceStable(pm.history, func(i, j int) bool {
+			return pm.history[i].AccessedAt.After(pm.history[j].AccessedAt)
+		})
+		for _, h := range pm.history[r.MaxEntries:] {
+			removed = append(removed, h.ID)
+		}
+		pm.history = pm.history[:r.MaxEntries]
+	}
+
+	return removed
+}
@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"nebula/backend/internal/fileutil"
+)
+
+// jsonBackupCount é quantas versões anteriores de cada arquivo JSON são
+// mantidas (arquivo.1 é a mais recente).
+const jsonBackupCount = 3
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// RecoveryEvent registra um arquivo corrompido encontrado ao carregar. Backup
+// é o arquivo usado no lugar; vazio se nenhum backup era válido e a coleção
+// começou vazia. Com o backend JSON o arquivo corrompido fica salvo com a
+// extensão .corrupt; a importação para o SQLite não altera os arquivos.
+type RecoveryEvent struct {
+	File   string    `json:"file"`
+	Backup string    `json:"backup,omitempty"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// jsonEnvelope é o formato gravado por saveJSON: o conteúdo e seu SHA-256.
+type jsonEnvelope struct {
+	SHA256 string          `json:"sha256"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// loadJSON lê path em v. Se o arquivo estiver corrompido, usa o backup válido
+// mais recente, regrava path a partir dele e retorna o RecoveryEvent.
+func loadJSON(path string, v interface{}) (*RecoveryEvent, error) {
+	event, err := readJSON(path, v)
+	if err != nil || event == nil {
+		return event, err
+	}
+
+	if err := os.Rename(path, path+".corrupt"); err != nil {
+		return nil, err
+	}
+	if err := saveJSON(path, v); err != nil {
+		return nil, fmt.Errorf("restore %s: %w", filepath.Base(path), err)
+	}
+	return event, nil
+}
+
+// readJSON faz o mesmo que loadJSON sem alterar nenhum arquivo: se path
+// estiver corrompido, v recebe o backup válido mais recente.
+func readJSON(path string, v interface{}) (*RecoveryEvent, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	payload, err := verifyJSON(raw)
+	if err == nil {
+		if err = decodeJSON(payload, v); err == nil {
+			return nil, nil
+		}
+	}
+
+	event := &RecoveryEvent{
+		File:  filepath.Base(path),
+		Error: err.Error(),
+		Time:  time.Now(),
+	}
+	for i := 1; i <= jsonBackupCount; i++ {
+		backup := backupPath(path, i)
+		raw, err := os.ReadFile(backup)
+		if err != nil {
+			continue
+		}
+		payload, err := verifyJSON(raw)
+		if err != nil {
+			continue
+		}
+		if decodeJSON(payload, v) == nil {
+			event.Backup = filepath.Base(backup)
+			break
+		}
+	}
+	return event, nil
+}
+
+// saveJSON grava v de forma atômica dentro de um jsonEnvelope, guardando a
+// versão anterior como backup.
+func saveJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	envelope := make([]byte, 0, len(data)+96)
+	envelope = append(envelope, `{"sha256":"`...)
+	envelope = append(envelope, hex.EncodeToString(sum[:])...)
+	envelope = append(envelope, `","data":`...)
+	envelope = append(envelope, data...)
+	envelope = append(envelope, '}')
+
+	if err := rotateBackups(path); err != nil {
+		return fmt.Errorf("rotate backups: %w", err)
+	}
+	return fileutil.WriteFileAtomic(path, envelope, 0644)
+}
+
+// verifyJSON confere o checksum do envelope e retorna o conteúdo. Arquivos
+// sem envelope, de versões anteriores, são aceitos se forem JSON válido.
+func verifyJSON(raw []byte) ([]byte, error) {
+	var env jsonEnvelope
+	if json.Unmarshal(raw, &env) == nil && env.SHA256 != "" {
+		sum := sha256.Sum256(env.Data)
+		if hex.EncodeToString(sum[:]) != env.SHA256 {
+			return nil, errChecksumMismatch
+		}
+		return env.Data, nil
+	}
+	if !json.Valid(raw) {
+		return nil, errors.New("invalid JSON")
+	}
+	return raw, nil
+}
+
+// decodeJSON só altera v se todo o conteúdo for decodificado, para que uma
+// tentativa falha não deixe registros pela metade.
+func decodeJSON(payload []byte, v interface{}) error {
+	target := reflect.New(reflect.TypeOf(v).Elem())
+	if err := json.Unmarshal(payload, target.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(v).Elem().Set(target.Elem())
+	return nil
+}
+
+// rotateBackups copia a versão atual de path para path.1, deslocando as
+// anteriores. Uma versão atual inválida não é copiada para não descartar um
+// backup bom.
+func rotateBackups(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if _, err := verifyJSON(raw); err != nil {
+		return nil
+	}
+
+	for i := jsonBackupCount; i > 1; i-- {
+		if err := os.Rename(backupPath(path, i-1), backupPath(path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fileutil.WriteFileAtomic(backupPath(path, 1), raw, 0644)
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
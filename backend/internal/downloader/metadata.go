@@ -0,0 +1,328 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/swarm"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	VersionV1     = "v1"
+	VersionV2     = "v2"
+	VersionHybrid = "hybrid"
+)
+
+// TorrentDetails reúne o que o usuário precisa para avaliar um torrent
+// antes de baixá-lo. Creation date, created-by e comment só existem no
+// arquivo .torrent; magnets recebem apenas o info dict dos peers.
+type TorrentDetails struct {
+	Name       string         `json:"name"`
+	InfoHash   string         `json:"info_hash"`
+	MagnetLink string         `json:"magnet_link"`
+	Files      []FileMetadata `json:"files"`
+	TotalSize  int64          `json:"total_size"`
+
+	PieceLength  int64      `json:"piece_length"`
+	PieceCount   int        `json:"piece_count"`
+	Private      bool       `json:"private"`
+	CreationDate *time.Time `json:"creation_date,omitempty"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	Comment      string     `json:"comment,omitempty"`
+	AnnounceList [][]string `json:"announce_list"`
+	WebSeeds     []string   `json:"web_seeds"`
+	Version      string     `json:"version"`
+
+	// Health só é preenchido quando a análise pede verificação do swarm.
+	Health *swarm.Health `json:"health,omitempty"`
+	// Tree só é preenchido quando a análise pede a árvore de arquivos.
+	Tree *FileTreeNode `json:"tree,omitempty"`
+}
+
+// Trackers retorna os trackers de todos os níveis do announce list.
+func (d *TorrentDetails) Trackers() []string {
+	var trackers []string
+	for _, tier := range d.AnnounceList {
+		trackers = append(trackers, tier...)
+	}
+	return trackers
+}
+
+// infoVersionFields são os campos do info dict que distinguem v1, v2 e
+// híbrido (BEP 52). O metainfo.Info do cliente ainda não os expõe.
+type infoVersionFields struct {
+	MetaVersion int           `bencode:"meta version,omitempty"`
+	FileTree    bencode.Bytes `bencode:"file tree,omitempty"`
+	Pieces      bencode.Bytes `bencode:"pieces,omitempty"`
+}
+
+func detectVersion(infoBytes []byte) string {
+	var fields infoVersionFields
+	if len(infoBytes) == 0 || bencode.Unmarshal(infoBytes, &fields) != nil {
+		return VersionV1
+	}
+	if fields.MetaVersion < 2 {
+		return VersionV1
+	}
+	if len(fields.Pieces) > 0 {
+		return VersionHybrid
+	}
+	return VersionV2
+}
+
+// newTorrentDetails descreve t, que já deve ter os metadados. file é o
+// metainfo original quando o torrent veio de um arquivo, ou nil para magnets.
+func newTorrentDetails(t *torrent.Torrent, file *metainfo.MetaInfo, magnetLink string) *TorrentDetails {
+	info := t.Info()
+	live := t.Metainfo()
+
+	details := &TorrentDetails{
+		Name:         t.Name(),
+		InfoHash:     t.InfoHash().HexString(),
+		MagnetLink:   magnetLink,
+		Files:        make([]FileMetadata, 0, len(t.Files())),
+		TotalSize:    t.Length(),
+		PieceLength:  info.PieceLength,
+		PieceCount:   t.NumPieces(),
+		Private:      info.Private != nil && *info.Private,
+		AnnounceList: live.UpvertedAnnounceList(),
+		WebSeeds:     []string(live.UrlList),
+		Version:      detectVersion(live.InfoBytes),
+	}
+
+	for i, f := range t.Files() {
+		details.Files = append(details.Files, *NewFileMetadata(i, f.Path(), f.Length()))
+	}
+
+	if file != nil {
+		details.AnnounceList = file.UpvertedAnnounceList()
+		details.WebSeeds = []string(file.UrlList)
+		details.Version = detectVersion(file.InfoBytes)
+		details.CreatedBy = file.CreatedBy
+		details.Comment = file.Comment
+		if file.CreationDate > 0 {
+			created := time.Unix(file.CreationDate, 0).UTC()
+			details.CreationDate = &created
+		}
+	}
+
+	if details.AnnounceList == nil {
+		details.AnnounceList = [][]string{}
+	}
+	if details.WebSeeds == nil {
+		details.WebSeeds = []string{}
+	}
+	return details
+}
+
+// AnalyzeMagnet obtém os metadados de um magnet pelos peers.
+func (s *Service) AnalyzeMagnet(magnetLink string) (*TorrentDetails, error) {
+	return s.AnalyzeMagnetContext(context.Background(), magnetLink, nil)
+}
+
+// AnalyzeMagnetContext é como AnalyzeMagnet, mas pode ser cancelado por ctx e
+// informa o número de peers conectados enquanto espera os metadados.
+// Resultados em cache retornam imediatamente.
+func (s *Service) AnalyzeMagnetContext(ctx context.Context, magnetLink string, onPeers func(peers int)) (*TorrentDetails, error) {
+	uri, err := resolveMagnet(magnetLink)
+	if err != nil {
+		return nil, err
+	}
+
+	infoHash, _ := magnet.InfoHash(uri)
+	if cached := s.cachedDetails(infoHash); cached != nil {
+		cached.MagnetLink = uri
+		return cached, nil
+	}
+
+	t, err := s.client.AddMagnet(uri)
+	if err != nil {
+		return nil, fmt.Errorf("add magnet: %w", err)
+	}
+	defer s.dropUnlessActive(t)
+
+	if err := waitForInfoContext(ctx, t, onPeers); err != nil {
+		return nil, err
+	}
+
+	details := newTorrentDetails(t, nil, uri)
+	s.cacheMetadata(details, t.Metainfo().InfoBytes)
+	return details, nil
+}
+
+// AnalyzeTorrentBytes descreve um arquivo .torrent.
+func (s *Service) AnalyzeTorrentBytes(data []byte) (*TorrentDetails, error) {
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse torrent data: %w", err)
+	}
+
+	t, err := s.client.AddTorrent(mi)
+	if err != nil {
+		return nil, fmt.Errorf("add torrent: %w", err)
+	}
+	defer s.dropUnlessActive(t)
+
+	if err := waitForInfo(t); err != nil {
+		return nil, err
+	}
+	details := newTorrentDetails(t, mi, mi.Magnet(nil, t.Info()).String())
+	s.cacheMetadata(details, mi.InfoBytes)
+	return details, nil
+}
+
+// dropUnlessActive remove t do cliente, exceto quando ele pertence a um
+// download em andamento (o cliente devolve o mesmo torrent para o mesmo hash).
+func (s *Service) dropUnlessActive(t *torrent.Torrent) {
+	if !s.IsActive(t.InfoHash().HexString()) {
+		t.Drop()
+	}
+}
+
+func waitForInfo(t *torrent.Torrent) error {
+	return waitForInfoContext(context.Background(), t, nil)
+}
+
+func waitForInfoContext(ctx context.Context, t *torrent.Torrent, onPeers func(peers int)) error {
+	timeout := time.NewTimer(MetadataTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.GotInfo():
+			return nil
+		case <-timeout.C:
+			return fmt.Errorf("timeout fetching metadata")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if onPeers != nil {
+				onPeers(t.Stats().ActivePeers)
+			}
+		}
+	}
+}
+
+// metadataCacheSize limita quantos info dicts ficam em memória.
+const metadataCacheSize = 128
+
+type cachedMetadata struct {
+	details   *TorrentDetails
+	infoBytes []byte
+	cachedAt  time.Time
+}
+
+// cacheMetadata guarda o info dict de um torrent analisado para que o
+// download comece sem esperar os metadados dos peers.
+func (s *Service) cacheMetadata(details *TorrentDetails, infoBytes []byte) {
+	if len(infoBytes) == 0 {
+		return
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if s.metaCache == nil {
+		s.metaCache = make(map[string]*cachedMetadata)
+	}
+	if _, exists := s.metaCache[details.InfoHash]; !exists && len(s.metaCache) >= metadataCacheSize {
+		var oldest string
+		for ih, entry := range s.metaCache {
+			if oldest == "" || entry.cachedAt.Before(s.metaCache[oldest].cachedAt) {
+				oldest = ih
+			}
+		}
+		delete(s.metaCache, oldest)
+	}
+
+	copied := *details
+	copied.Health = nil
+	copied.Tree = nil
+	s.metaCache[details.InfoHash] = &cachedMetadata{
+		details:   &copied,
+		infoBytes: infoBytes,
+		cachedAt:  time.Now(),
+	}
+}
+
+// CachedDetails retorna os metadados em cache de um torrent já analisado ou
+// baixado nesta sessão, ou nil.
+func (s *Service) CachedDetails(infoHash string) *TorrentDetails {
+	return s.cachedDetails(infoHash)
+}
+
+func (s *Service) cachedDetails(infoHash string) *TorrentDetails {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	entry, ok := s.metaCache[infoHash]
+	if !ok {
+		return nil
+	}
+	copied := *entry.details
+	return &copied
+}
+
+func (s *Service) cachedInfoBytes(infoHash string) []byte {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if entry, ok := s.metaCache[infoHash]; ok {
+		return entry.infoBytes
+	}
+	return nil
+}
+
+// SampleDHTPeers procura peers do torrent no DHT até ctx expirar, sem se
+// anunciar, e retorna quantos endereços distintos apareceram.
+func (s *Service) SampleDHTPeers(ctx context.Context, infoHash [20]byte) (int, error) {
+	servers := s.client.DhtServers()
+	if len(servers) == 0 {
+		return 0, fmt.Errorf("dht disabled")
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		announce, err := server.Announce(infoHash, 0, false)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer announce.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case values, ok := <-announce.Peers():
+					if !ok {
+						return
+					}
+					mu.Lock()
+					for _, peer := range values.Peers {
+						seen[peer.String()] = true
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return len(seen), nil
+}
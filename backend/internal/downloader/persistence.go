@@ -1,19 +1,22 @@
 package downloader
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/postprocess"
+	"nebula/backend/internal/selection"
 )
 
 type DownloadRecord struct {
 	ID              string    `json:"id"`
 	MagnetLink      string    `json:"magnet_link"`
+	InfoHash        string    `json:"info_hash,omitempty"`
 	OutputDir       string    `json:"output_dir"`
 	SelectedIndices []int     `json:"selected_indices"`
 	Status          string    `json:"status"`
@@ -23,11 +26,31 @@ type DownloadRecord struct {
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 	ErrorMessage    string    `json:"error_message,omitempty"`
+	Allocation      string    `json:"allocation,omitempty"`
+	// SelectionPolicy é usada quando o download começou sem índices
+	SelectionPolicy string `json:"selection_policy,omitempty"`
+	// SelectionRules filtram a seleção depois dos metadados
+	SelectionRules *selection.Rules `json:"selection_rules,omitempty"`
+
+	Sequential bool             `json:"sequential,omitempty"`
+	Preset     string           `json:"preset,omitempty"`
+	Tags       []string         `json:"tags,omitempty"`
+	Transfer   *TransferOptions `json:"transfer,omitempty"`
+	// Private não grava histórico e o registro some de downloads.json
+	// depois de concluído (continua em memória até ser removido)
+	Private bool `json:"private,omitempty"`
+
+	OnComplete    []postprocess.Action `json:"on_complete,omitempty"`
+	ActionResults []postprocess.Result `json:"action_results,omitempty"`
+
+	ExtractArchives *bool                       `json:"extract_archives,omitempty"`
+	ExtractResults  []postprocess.ExtractResult `json:"extract_results,omitempty"`
 }
 
 type HistoryRecord struct {
 	ID          int       `json:"id"`
 	MagnetLink  string    `json:"magnet_link"`
+	InfoHash    string    `json:"info_hash"`
 	TorrentName string    `json:"torrent_name"`
 	FileCount   int       `json:"file_count"`
 	TotalSize   int64     `json:"total_size"`
@@ -37,81 +60,117 @@ type HistoryRecord struct {
 type FavoriteRecord struct {
 	ID          int       `json:"id"`
 	MagnetLink  string    `json:"magnet_link"`
+	InfoHash    string    `json:"info_hash"`
 	TorrentName string    `json:"torrent_name"`
 	Tags        []string  `json:"tags"`
 	Notes       string    `json:"notes,omitempty"`
 	AddedAt     time.Time `json:"added_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	// Download salvo para baixar o favorito sem analisar de novo
+	Download *FavoriteDownload `json:"download,omitempty"`
+}
+
+// FavoriteDownload guarda como um favorito deve ser baixado: índices ou
+// regras de seleção, destino e preset de download.
+type FavoriteDownload struct {
+	SelectedIndices []int            `json:"selected_indices,omitempty"`
+	SelectionPreset string           `json:"selection_preset,omitempty"`
+	Rules           *selection.Rules `json:"rules,omitempty"`
+	OutputDir       string           `json:"output_dir,omitempty"`
+	DownloadPreset  string           `json:"download_preset,omitempty"`
 }
 
+// PersistenceManager mantém downloads, histórico e favoritos em memória e
+// grava cada alteração no Store configurado.
 type PersistenceManager struct {
-	dir           string
-	downloadsPath string
-	historyPath   string
-	favoritesPath string
-	mu            sync.RWMutex
+	dir   string
+	store Store
+	mu    sync.RWMutex
+	// writeMu mantém as gravações no store na ordem das alterações em
+	// memória sem segurar mu durante a escrita
+	writeMu sync.Mutex
 
 	downloads map[string]*DownloadRecord
 	history   []*HistoryRecord
 	favorites []*FavoriteRecord
 
-	saveTimer    *time.Timer
-	pendingSave  bool
-	saveMu       sync.Mutex
+	retention HistoryRetention
+	recovered []RecoveryEvent
 }
 
-func NewPersistenceManager(appDataDir string) (*PersistenceManager, error) {
+// NewPersistenceManager abre o backend de persistência ("json" ou "sqlite")
+// em appDataDir e carrega os registros.
+func NewPersistenceManager(appDataDir, backend string) (*PersistenceManager, error) {
 	if err := os.MkdirAll(appDataDir, 0755); err != nil {
 		return nil, fmt.Errorf("create app data dir: %w", err)
 	}
 
-	pm := &PersistenceManager{
-		dir:           appDataDir,
-		downloadsPath: filepath.Join(appDataDir, "downloads.json"),
-		historyPath:   filepath.Join(appDataDir, "history.json"),
-		favoritesPath: filepath.Join(appDataDir, "favorites.json"),
-		downloads:     make(map[string]*DownloadRecord),
-		history:       make([]*HistoryRecord, 0),
-		favorites:     make([]*FavoriteRecord, 0),
+	store, err := OpenStore(backend, appDataDir)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
 	}
 
-	if err := pm.loadAll(); err != nil {
+	data, err := store.Load()
+	if err != nil {
+		store.Close()
 		return nil, err
 	}
 
-	return pm, nil
+	return &PersistenceManager{
+		dir:       appDataDir,
+		store:     store,
+		downloads: data.Downloads,
+		history:   data.History,
+		favorites: data.Favorites,
+		recovered: data.Recovered,
+	}, nil
 }
 
-func (pm *PersistenceManager) loadAll() error {
-	if err := pm.loadJSON(pm.downloadsPath, &pm.downloads); err != nil {
-		return fmt.Errorf("load downloads: %w", err)
-	}
-	if err := pm.loadJSON(pm.historyPath, &pm.history); err != nil {
-		return fmt.Errorf("load history: %w", err)
-	}
-	if err := pm.loadJSON(pm.favoritesPath, &pm.favorites); err != nil {
-		return fmt.Errorf("load favorites: %w", err)
+// Recoveries lista os arquivos corrompidos restaurados de backup ao abrir.
+func (pm *PersistenceManager) Recoveries() []RecoveryEvent {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return append([]RecoveryEvent(nil), pm.recovered...)
+}
+
+// unlockForWrite troca mu por writeMu. Deve ser chamado com mu travado;
+// retorna a função que libera writeMu depois da gravação.
+func (pm *PersistenceManager) unlockForWrite() func() {
+	pm.writeMu.Lock()
+	pm.mu.Unlock()
+	return pm.writeMu.Unlock
+}
+
+// infoHashKey identifica um torrent pelo info hash canônico. Links que não
+// são magnets válidos (registros antigos) usam o próprio texto como chave.
+func infoHashKey(link string) string {
+	if ih, err := magnet.InfoHash(link); err == nil {
+		return ih
 	}
-	return nil
+	return strings.TrimSpace(link)
 }
 
-func (pm *PersistenceManager) loadJSON(path string, v interface{}) error {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
+func normalizeLink(link string) string {
+	if normalized, err := magnet.Normalize(link); err == nil {
+		return normalized
 	}
-	return json.Unmarshal(data, v)
+	return link
 }
 
-func (pm *PersistenceManager) saveJSON(path string, v interface{}) error {
-	data, err := json.Marshal(v)
-	if err != nil {
-		return err
+func mergeTags(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	merged := append([]string{}, a...)
+	for _, t := range a {
+		seen[t] = true
 	}
-	return os.WriteFile(path, data, 0644)
+	for _, t := range b {
+		if !seen[t] {
+			seen[t] = true
+			merged = append(merged, t)
+		}
+	}
+	return merged
 }
 
 // --- Downloads ---
@@ -119,41 +178,18 @@ func (pm *PersistenceManager) saveJSON(path string, v interface{}) error {
 func (pm *PersistenceManager) SaveDownload(record *DownloadRecord) error {
 	pm.mu.Lock()
 	record.UpdatedAt = time.Now()
+	if record.InfoHash == "" && record.MagnetLink != "" {
+		record.InfoHash = infoHashKey(record.MagnetLink)
+	}
 	pm.downloads[record.ID] = record
-	pm.mu.Unlock()
-
-	pm.scheduleSave()
-	return nil
-}
+	saved := *record
+	defer pm.unlockForWrite()()
 
-func (pm *PersistenceManager) scheduleSave() {
-	pm.saveMu.Lock()
-	defer pm.saveMu.Unlock()
-
-	pm.pendingSave = true
-
-	if pm.saveTimer != nil {
-		pm.saveTimer.Stop()
+	// Downloads privados concluídos ficam só em memória
+	if saved.Private && saved.Status == "completed" {
+		return pm.store.DeleteDownloads(saved.ID)
 	}
-
-	pm.saveTimer = time.AfterFunc(2*time.Second, func() {
-		pm.saveMu.Lock()
-		if !pm.pendingSave {
-			pm.saveMu.Unlock()
-			return
-		}
-		pm.pendingSave = false
-		pm.saveMu.Unlock()
-
-		pm.mu.RLock()
-		downloadsCopy := make(map[string]*DownloadRecord, len(pm.downloads))
-		for k, v := range pm.downloads {
-			downloadsCopy[k] = v
-		}
-		pm.mu.RUnlock()
-
-		pm.saveJSON(pm.downloadsPath, downloadsCopy)
-	})
+	return pm.store.PutDownload(&saved)
 }
 
 func (pm *PersistenceManager) GetDownload(id string) (*DownloadRecord, error) {
@@ -181,72 +217,94 @@ func (pm *PersistenceManager) GetAllDownloads() ([]*DownloadRecord, error) {
 	return all, nil
 }
 
-func (pm *PersistenceManager) GetIncompleteDownloads() ([]*DownloadRecord, error) {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
+// QueryDownloads retorna os downloads que atendem ao filtro, do mais
+// recentemente atualizado para o mais antigo. Inclui os privados concluídos,
+// que só existem em memória.
+func (pm *PersistenceManager) QueryDownloads(filter DownloadFilter) ([]*DownloadRecord, error) {
+	records, err := pm.store.QueryDownloads(filter)
+	if err != nil {
+		return nil, err
+	}
 
-	var incomplete []*DownloadRecord
+	seen := make(map[string]bool, len(records))
+	for _, r := range records {
+		seen[r.ID] = true
+	}
+	pm.mu.RLock()
 	for _, r := range pm.downloads {
-		if r.Status == "paused" || r.Status == "downloading" || r.Status == "error" {
+		if r.Private && r.Status == "completed" && !seen[r.ID] && filter.matches(r) {
 			copy := *r
-			incomplete = append(incomplete, &copy)
+			records = append(records, &copy)
 		}
 	}
+	pm.mu.RUnlock()
 
-	sort.Slice(incomplete, func(i, j int) bool {
-		return incomplete[i].UpdatedAt.After(incomplete[j].UpdatedAt)
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UpdatedAt.After(records[j].UpdatedAt)
 	})
+	return records, nil
+}
 
-	return incomplete, nil
+func (pm *PersistenceManager) GetIncompleteDownloads() ([]*DownloadRecord, error) {
+	return pm.store.QueryDownloads(DownloadFilter{
+		Status: []string{"paused", "downloading", "seeding", "error"},
+	})
 }
 
 func (pm *PersistenceManager) DeleteDownload(id string) error {
 	pm.mu.Lock()
 	delete(pm.downloads, id)
-	pm.mu.Unlock()
+	defer pm.unlockForWrite()()
 
-	pm.mu.RLock()
-	downloadsCopy := make(map[string]*DownloadRecord, len(pm.downloads))
-	for k, v := range pm.downloads {
-		downloadsCopy[k] = v
-	}
-	pm.mu.RUnlock()
-
-	return pm.saveJSON(pm.downloadsPath, downloadsCopy)
+	return pm.store.DeleteDownloads(id)
 }
 
 // --- History ---
 
 func (pm *PersistenceManager) AddToHistory(magnetLink, torrentName string, fileCount int, totalSize int64) error {
+	key := infoHashKey(magnetLink)
+	magnetLink = normalizeLink(magnetLink)
+
 	pm.mu.Lock()
-	defer pm.mu.Unlock()
-
-	for i := range pm.history {
-		if pm.history[i].MagnetLink == magnetLink {
-			pm.history[i].AccessedAt = time.Now()
-			pm.history[i].FileCount = fileCount
-			pm.history[i].TotalSize = totalSize
-			return pm.saveJSON(pm.historyPath, pm.history)
+	var record *HistoryRecord
+	for _, r := range pm.history {
+		if r.InfoHash == key {
+			r.MagnetLink = magnetLink
+			r.AccessedAt = time.Now()
+			r.FileCount = fileCount
+			r.TotalSize = totalSize
+			record = r
+			break
 		}
 	}
 
-	newID := 1
-	for _, r := range pm.history {
-		if r.ID >= newID {
-			newID = r.ID + 1
+	if record == nil {
+		newID := 1
+		for _, r := range pm.history {
+			if r.ID >= newID {
+				newID = r.ID + 1
+			}
 		}
+
+		record = &HistoryRecord{
+			ID:          newID,
+			MagnetLink:  magnetLink,
+			InfoHash:    key,
+			TorrentName: torrentName,
+			FileCount:   fileCount,
+			TotalSize:   totalSize,
+			AccessedAt:  time.Now(),
+		}
+		pm.history = append(pm.history, record)
 	}
+	saved := *record
+	removed := pm.pruneHistory()
+	defer pm.unlockForWrite()()
 
-	record := &HistoryRecord{
-		ID:          newID,
-		MagnetLink:  magnetLink,
-		TorrentName: torrentName,
-		FileCount:   fileCount,
-		TotalSize:   totalSize,
-		AccessedAt:  time.Now(),
+	if err := pm.store.PutHistory(&saved); err != nil {
+		return err
 	}
-	pm.history = append(pm.history, record)
-	return pm.saveJSON(pm.historyPath, pm.history)
+	return pm.store.DeleteHistory(removed...)
 }
 
 func (pm *PersistenceManager) GetHistory(limit int) ([]*HistoryRecord, error) {
@@ -269,41 +327,30 @@ func (pm *PersistenceManager) GetHistory(limit int) ([]*HistoryRecord, error) {
 	return sorted, nil
 }
 
-func (pm *PersistenceManager) SearchHistory(query string) ([]*HistoryRecord, error) {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-
-	query = strings.ToLower(query)
-	var results []*HistoryRecord
-	for _, r := range pm.history {
-		if strings.Contains(strings.ToLower(r.TorrentName), query) || strings.Contains(strings.ToLower(r.MagnetLink), query) {
-			results = append(results, r)
-		}
-	}
-
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].AccessedAt.After(results[j].AccessedAt)
-	})
-
-	if len(results) > 50 {
-		results = results[:50]
-	}
-	return results, nil
-}
-
 // --- Favorites ---
 
-func (pm *PersistenceManager) AddFavorite(magnetLink, torrentName string, tags []string, notes string) error {
+// AddFavorite cria ou atualiza o favorito do torrent. download nil mantém o
+// download salvo de um favorito existente.
+func (pm *PersistenceManager) AddFavorite(magnetLink, torrentName string, tags []string, notes string, download *FavoriteDownload) error {
+	key := infoHashKey(magnetLink)
+	magnetLink = normalizeLink(magnetLink)
+	tags = cleanTags(tags)
+
 	pm.mu.Lock()
-	defer pm.mu.Unlock()
 
 	// Check if exists
 	for _, r := range pm.favorites {
-		if r.MagnetLink == magnetLink {
+		if r.InfoHash == key {
+			r.MagnetLink = magnetLink
 			r.Tags = tags
 			r.Notes = notes
+			if download != nil {
+				r.Download = download
+			}
 			r.UpdatedAt = time.Now()
-			return pm.saveJSON(pm.favoritesPath, pm.favorites)
+			saved := *r
+			defer pm.unlockForWrite()()
+			return pm.store.PutFavorites(&saved)
 		}
 	}
 
@@ -319,26 +366,32 @@ func (pm *PersistenceManager) AddFavorite(magnetLink, torrentName string, tags [
 	record := &FavoriteRecord{
 		ID:          newID,
 		MagnetLink:  magnetLink,
+		InfoHash:    key,
 		TorrentName: torrentName,
 		Tags:        tags,
 		Notes:       notes,
 		AddedAt:     time.Now(),
 		UpdatedAt:   time.Now(),
+		Download:    download,
 	}
 	pm.favorites = append(pm.favorites, record)
-	return pm.saveJSON(pm.favoritesPath, pm.favorites)
+	saved := *record
+	defer pm.unlockForWrite()()
+	return pm.store.PutFavorites(&saved)
 }
 
 func (pm *PersistenceManager) RemoveFavorite(magnetLink string) error {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+	key := infoHashKey(magnetLink)
 
+	pm.mu.Lock()
 	for i, r := range pm.favorites {
-		if r.MagnetLink == magnetLink {
+		if r.InfoHash == key {
 			pm.favorites = append(pm.favorites[:i], pm.favorites[i+1:]...)
-			return pm.saveJSON(pm.favoritesPath, pm.favorites)
+			defer pm.unlockForWrite()()
+			return pm.store.DeleteFavorites(r.ID)
 		}
 	}
+	pm.mu.Unlock()
 	return nil
 }
 
@@ -347,19 +400,233 @@ func (pm *PersistenceManager) GetFavorites() ([]*FavoriteRecord, error) {
 	defer pm.mu.RUnlock()
 
 	sorted := make([]*FavoriteRecord, len(pm.favorites))
-	copy(sorted, pm.favorites)
+	for i, r := range pm.favorites {
+		copy := *r
+		sorted[i] = &copy
+	}
 	sort.Slice(sorted, func(i, j int) bool {
 		return sorted[i].AddedAt.After(sorted[j].AddedAt)
 	})
 	return sorted, nil
 }
 
+// Ordenações aceitas por QueryFavorites
+const (
+	FavoriteSortAdded   = "added_at"
+	FavoriteSortUpdated = "updated_at"
+	FavoriteSortName    = "name"
+)
+
+// FavoriteQuery filtra e ordena a listagem de favoritos. Um favorito precisa
+// ter todas as Tags (sem diferenciar maiúsculas); Text é buscado no nome,
+// nas notas, nas tags e no info hash.
+type FavoriteQuery struct {
+	Tags []string
+	Text string
+	Sort string
+	Desc bool
+}
+
+// FavoriteUpdate altera apenas os campos preenchidos de um favorito.
+type FavoriteUpdate struct {
+	Name     *string
+	Tags     *[]string
+	Notes    *string
+	Download *FavoriteDownload
+}
+
+// TagCount é uma tag com o número de favoritos que a usam.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func (pm *PersistenceManager) QueryFavorites(q FavoriteQuery) ([]*FavoriteRecord, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	text := strings.ToLower(strings.TrimSpace(q.Text))
+	var results []*FavoriteRecord
+	for _, r := range pm.favorites {
+		if !hasAllTags(r.Tags, q.Tags) {
+			continue
+		}
+		if text != "" && !favoriteContains(r, text) {
+			continue
+		}
+		copy := *r
+		results = append(results, &copy)
+	}
+
+	less := func(a, b *FavoriteRecord) bool { return a.AddedAt.Before(b.AddedAt) }
+	switch q.Sort {
+	case FavoriteSortUpdated:
+		less = func(a, b *FavoriteRecord) bool { return a.UpdatedAt.Before(b.UpdatedAt) }
+	case FavoriteSortName:
+		less = func(a, b *FavoriteRecord) bool {
+			return strings.ToLower(a.TorrentName) < strings.ToLower(b.TorrentName)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if q.Desc {
+			return less(results[j], results[i])
+		}
+		return less(results[i], results[j])
+	})
+	return results, nil
+}
+
+func hasAllTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, t := range tags {
+			if strings.EqualFold(t, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func favoriteContains(r *FavoriteRecord, text string) bool {
+	if strings.Contains(strings.ToLower(r.TorrentName), text) ||
+		strings.Contains(strings.ToLower(r.Notes), text) ||
+		strings.Contains(r.InfoHash, text) {
+		return true
+	}
+	for _, t := range r.Tags {
+		if strings.Contains(strings.ToLower(t), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateFavorite aplica update ao favorito e retorna uma cópia atualizada,
+// ou nil se o id não existir.
+func (pm *PersistenceManager) UpdateFavorite(id int, update FavoriteUpdate) (*FavoriteRecord, error) {
+	pm.mu.Lock()
+
+	for _, r := range pm.favorites {
+		if r.ID != id {
+			continue
+		}
+		if update.Name != nil {
+			r.TorrentName = *update.Name
+		}
+		if update.Tags != nil {
+			r.Tags = cleanTags(*update.Tags)
+		}
+		if update.Notes != nil {
+			r.Notes = *update.Notes
+		}
+		if update.Download != nil {
+			r.Download = update.Download
+		}
+		r.UpdatedAt = time.Now()
+		saved := *r
+		defer pm.unlockForWrite()()
+		if err := pm.store.PutFavorites(&saved); err != nil {
+			return nil, err
+		}
+		copy := saved
+		return &copy, nil
+	}
+	pm.mu.Unlock()
+	return nil, nil
+}
+
+// FavoriteTags lista as tags em uso, das mais usadas para as menos usadas.
+// Tags que diferem só em maiúsculas contam juntas e aparecem na grafia mais
+// usada.
+func (pm *PersistenceManager) FavoriteTags() []TagCount {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	counts := make(map[string]int)
+	spellings := make(map[string]map[string]int)
+	for _, r := range pm.favorites {
+		seen := make(map[string]bool, len(r.Tags))
+		for _, t := range r.Tags {
+			key := strings.ToLower(t)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			counts[key]++
+			if spellings[key] == nil {
+				spellings[key] = make(map[string]int)
+			}
+			spellings[key][t]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for key, count := range counts {
+		tags = append(tags, TagCount{Tag: displayTag(spellings[key]), Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return strings.ToLower(tags[i].Tag) < strings.ToLower(tags[j].Tag)
+	})
+	return tags
+}
+
+// displayTag escolhe a grafia mais usada de uma tag; no empate, a menor.
+func displayTag(spellings map[string]int) string {
+	best, bestCount := "", 0
+	for t, n := range spellings {
+		if n > bestCount || n == bestCount && t < best {
+			best, bestCount = t, n
+		}
+	}
+	return best
+}
+
+// cleanTags remove espaços, tags vazias e repetidas (sem diferenciar
+// maiúsculas), preservando a ordem.
+func cleanTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	cleaned := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		key := strings.ToLower(t)
+		if t == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		cleaned = append(cleaned, t)
+	}
+	return cleaned
+}
+
+// GetFavorite retorna uma cópia do favorito com o id dado, ou nil.
+func (pm *PersistenceManager) GetFavorite(id int) (*FavoriteRecord, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, r := range pm.favorites {
+		if r.ID == id {
+			copy := *r
+			return &copy, nil
+		}
+	}
+	return nil, nil
+}
+
 func (pm *PersistenceManager) IsFavorite(magnetLink string) (bool, error) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
+	key := infoHashKey(magnetLink)
 	for _, r := range pm.favorites {
-		if r.MagnetLink == magnetLink {
+		if r.InfoHash == key {
 			return true, nil
 		}
 	}
@@ -367,19 +634,5 @@ func (pm *PersistenceManager) IsFavorite(magnetLink string) (bool, error) {
 }
 
 func (pm *PersistenceManager) Close() error {
-	pm.saveMu.Lock()
-	if pm.saveTimer != nil {
-		pm.saveTimer.Stop()
-	}
-	if pm.pendingSave {
-		pm.mu.RLock()
-		downloadsCopy := make(map[string]*DownloadRecord, len(pm.downloads))
-		for k, v := range pm.downloads {
-			downloadsCopy[k] = v
-		}
-		pm.mu.RUnlock()
-		pm.saveJSON(pm.downloadsPath, downloadsCopy)
-	}
-	pm.saveMu.Unlock()
-	return nil
+	return pm.store.Close()
 }
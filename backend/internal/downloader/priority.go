@@ -3,6 +3,8 @@ package downloader
 import (
 	"fmt"
 
+	"nebula/backend/internal/magnet"
+
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/types"
 )
@@ -20,13 +22,7 @@ func (s *Service) SetFilePriority(magnetLink string, fileIndex int, priority Fil
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var targetTorrent *torrent.Torrent
-	for _, t := range s.client.Torrents() {
-		if t.InfoHash().String() == magnetLink || t.Metainfo().Magnet(nil, t.Info()).String() == magnetLink {
-			targetTorrent = t
-			break
-		}
-	}
+	targetTorrent := s.findTorrent(magnetLink)
 
 	if targetTorrent == nil {
 		return fmt.Errorf("torrent not found")
@@ -61,13 +57,7 @@ func (s *Service) GetFilePriority(magnetLink string, fileIndex int) (FilePriorit
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var targetTorrent *torrent.Torrent
-	for _, t := range s.client.Torrents() {
-		if t.InfoHash().String() == magnetLink || t.Metainfo().Magnet(nil, t.Info()).String() == magnetLink {
-			targetTorrent = t
-			break
-		}
-	}
+	targetTorrent := s.findTorrent(magnetLink)
 
 	if targetTorrent == nil {
 		return PriorityNone, fmt.Errorf("torrent not found")
@@ -94,3 +84,18 @@ func (s *Service) GetFilePriority(magnetLink string, fileIndex int) (FilePriorit
 		return PriorityNormal, nil
 	}
 }
+
+// findTorrent localiza o torrent ativo pelo info hash canônico de link, que
+// pode ser um magnet em qualquer forma aceita ou o hash solto.
+func (s *Service) findTorrent(link string) *torrent.Torrent {
+	infoHash, err := magnet.InfoHash(link)
+	if err != nil {
+		return nil
+	}
+	for _, t := range s.client.Torrents() {
+		if t.InfoHash().HexString() == infoHash {
+			return t
+		}
+	}
+	return nil
+}
@@ -1,14 +1,17 @@
 package downloader
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"nebula/backend/internal/fileutil"
+	"nebula/backend/internal/magnet"
+
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
@@ -18,12 +21,45 @@ import (
 type Service struct {
 	client          *torrent.Client
 	config          *DownloadConfig
+	// baseDir é o diretório do armazenamento padrão do cliente; dataDir é o
+	// destino atual dos downloads sem diretório próprio
+	baseDir         string
+	dataDir         string
 	downloadLimiter *rate.Limiter
 	uploadLimiter   *rate.Limiter
 	mu              sync.RWMutex
+
+	diskReserve     int64
+	queueOnLowSpace bool
+
+	storage        storage.ClientImplCloser
+	completion     storage.PieceCompletion
+	storageBackend string
+	// dirStorages guarda o armazenamento de cada diretório de destino
+	// diferente de dataDir
+	dirStorages map[string]storage.ClientImpl
+	dirMu       sync.Mutex
+	preallocate    bool
+	torrentDir     string
+
+	// active indexa os downloads em andamento pelo info hash canônico
+	active   map[string]*activeDownload
+	activeMu sync.Mutex
+
+	// metaCache guarda info dicts já analisados, indexados pelo info hash
+	metaCache map[string]*cachedMetadata
+	cacheMu   sync.Mutex
 }
 
-func NewService(config *DownloadConfig, outputDir string) (*Service, error) {
+// activeDownload recebe arquivos adicionados à seleção enquanto o download
+// está em andamento; o laço de progresso os habilita no próximo ciclo.
+type activeDownload struct {
+	mu      sync.Mutex
+	torrent *torrent.Torrent
+	pending []int
+}
+
+func NewService(config *DownloadConfig, outputDir string, storageOpts StorageOptions) (*Service, error) {
 	if outputDir == "" {
 		outputDir = "."
 	}
@@ -39,14 +75,14 @@ func NewService(config *DownloadConfig, outputDir string) (*Service, error) {
 
 	// === OTIMIZAÇÕES DE VELOCIDADE ===
 
-	// Storage: usar NewFile quando CGO está desabilitado (Windows e Linux)
-	// NewMMap requer CGO, então usamos NewFile como fallback
-	// NewFile ainda oferece boa performance e é mais portátil (static linked)
-	if os.Getenv("CGO_ENABLED") == "0" {
-		cfg.DefaultStorage = storage.NewFile(outputDir)
-	} else {
-		cfg.DefaultStorage = storage.NewMMap(outputDir)
+	// Storage: definido em AppConfig.StorageBackend (file por padrão, o mais
+	// portátil). A conclusão das peças fica num banco no diretório de dados
+	// da aplicação, evitando nova verificação ao reiniciar.
+	store, completion, storageBackend, err := newStorage(storageOpts, outputDir)
+	if err != nil {
+		return nil, err
 	}
+	cfg.DefaultStorage = store
 
 	// Habilitar DHT para descoberta de peers
 	cfg.NoDHT = false
@@ -88,12 +124,23 @@ func NewService(config *DownloadConfig, outputDir string) (*Service, error) {
 
 	client, err := torrent.NewClient(cfg)
 	if err != nil {
+		store.Close()
 		return nil, fmt.Errorf("create client: %w", err)
 	}
 
+	log.Printf("[Service] Storage backend: %s", storageBackend)
+
 	return &Service{
 		client:          client,
 		config:          config,
+		baseDir:         filepath.Clean(outputDir),
+		dataDir:         outputDir,
+		storage:         store,
+		completion:      completion,
+		storageBackend:  storageBackend,
+		dirStorages:     make(map[string]storage.ClientImpl),
+		torrentDir:      storageOpts.TorrentDir,
+		active:          make(map[string]*activeDownload),
 		downloadLimiter: downloadLimiter,
 		uploadLimiter:   uploadLimiter,
 	}, nil
@@ -103,6 +150,14 @@ func (s *Service) Close() {
 	if s.client != nil {
 		s.client.Close()
 	}
+	if s.storage != nil {
+		s.storage.Close()
+	}
+}
+
+// StorageBackend retorna o backend de armazenamento em uso.
+func (s *Service) StorageBackend() string {
+	return s.storageBackend
 }
 
 func (s *Service) UpdateLimits(config *DownloadConfig) {
@@ -129,47 +184,206 @@ func (s *Service) UpdateLimits(config *DownloadConfig) {
 	}
 }
 
-func (s *Service) Download(ctx context.Context, id string, magnetLink string, selectedIndices []int, sequential bool, reporter ProgressReporter, pauseManager *PauseManager) error {
-	if err := ValidateMagnetLink(magnetLink); err != nil {
-		return err
+// SetSpacePolicy define quantos bytes devem permanecer livres no volume de
+// destino e se downloads que não cabem aguardam espaço em vez de falhar.
+func (s *Service) SetSpacePolicy(reserve int64, queue bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diskReserve = reserve
+	s.queueOnLowSpace = queue
+}
+
+// DataDir retorna o diretório onde são gravados os downloads sem diretório
+// próprio.
+func (s *Service) DataDir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dataDir
+}
+
+// SetDataDir troca o diretório dos próximos downloads sem diretório próprio.
+// Os que estão em andamento continuam onde estão.
+func (s *Service) SetDataDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create output dir: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dataDir = dir
+	return nil
+}
+
+// DownloadDir retorna o diretório em que um download com destino outputDir
+// é gravado: o próprio outputDir, relativo a DataDir quando não é absoluto,
+// ou DataDir quando vazio.
+func (s *Service) DownloadDir(outputDir string) string {
+	dataDir := s.DataDir()
+	if outputDir == "" {
+		return filepath.Clean(dataDir)
+	}
+	if !filepath.IsAbs(outputDir) {
+		return filepath.Join(dataDir, outputDir)
+	}
+	return filepath.Clean(outputDir)
+}
+
+// storageFor retorna o armazenamento de dir, ou nil quando o padrão do
+// cliente serve (dir é o diretório dele ou o backend é em memória).
+func (s *Service) storageFor(dir string) storage.ClientImpl {
+	if dir == s.baseDir || s.completion == nil {
+		return nil
+	}
+	s.dirMu.Lock()
+	defer s.dirMu.Unlock()
+
+	st, ok := s.dirStorages[dir]
+	if !ok {
+		st = newDirStorage(s.storageBackend, dir, s.completion)
+		s.dirStorages[dir] = st
+	}
+	return st
+}
+
+// SetPreallocate habilita a pré-alocação completa dos arquivos selecionados.
+// Só tem efeito com o backend de arquivos; no mmap os arquivos continuam esparsos.
+func (s *Service) SetPreallocate(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preallocate = enabled
+}
+
+// AllocationMode retorna AllocationFull quando os arquivos selecionados são
+// pré-alocados e AllocationSparse caso contrário.
+func (s *Service) AllocationMode() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.preallocate && s.storageBackend == StorageFile {
+		return AllocationFull
+	}
+	return AllocationSparse
+}
+
+// preallocateFiles reserva o tamanho final dos arquivos selecionados que
+// ainda não estão completos, falhando cedo se o disco não comportar.
+func (s *Service) preallocateFiles(t *torrent.Torrent, dir string, selectedSet map[int]bool) error {
+	for i, file := range t.Files() {
+		if !selectedSet[i] || file.BytesCompleted() >= file.Length() {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(file.Path()))
+		if err := fileutil.PreallocateFile(path, file.Length()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForSpace verifica se os bytes restantes da seleção cabem no volume de
+// destino mantendo a reserva configurada. Com a fila habilitada, aguarda até
+// haver espaço; caso contrário retorna ErrInsufficientSpace.
+func (s *Service) waitForSpace(ctx context.Context, id, dir string, remaining int64, reporter ProgressReporter) error {
+	notified := false
+	for {
+		s.mu.RLock()
+		reserve, queue := s.diskReserve, s.queueOnLowSpace
+		s.mu.RUnlock()
+
+		usage, err := fileutil.FreeSpace(dir)
+		if err != nil {
+			log.Printf("[Download] WARNING: could not check free space for %s: %v", dir, err)
+			return nil
+		}
+
+		needed := remaining + reserve
+		if usage.Free >= needed {
+			return nil
+		}
+
+		if !queue {
+			return fmt.Errorf("%w: need %d bytes (including %d reserved), %d free", ErrInsufficientSpace, needed, reserve, usage.Free)
+		}
+
+		if !notified && reporter != nil {
+			reporter.OnLog(id, "Waiting for disk space")
+			reporter.OnEvent(id, "disk_wait", map[string]interface{}{
+				"needed": needed,
+				"free":   usage.Free,
+			})
+			notified = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(DiskSpaceRetryInterval):
+		}
+	}
+}
+
+// Download baixa os arquivos selecionados em outputDir (vazio usa DataDir).
+func (s *Service) Download(ctx context.Context, id string, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter ProgressReporter, pauseManager *PauseManager, transfer TransferOptions) (*DownloadResult, error) {
+	uri, err := resolveMagnet(magnetLink)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(selectedIndices) == 0 {
-		return fmt.Errorf("no files selected")
+		return nil, fmt.Errorf("no files selected")
 	}
 
-	t, err := s.client.AddMagnet(magnetLink)
+	dir := s.DownloadDir(outputDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create output dir: %w", err)
+	}
+
+	infoHash, _ := magnet.InfoHash(uri)
+	active, err := s.registerActive(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unregisterActive(infoHash)
+
+	t, err := s.addMagnet(uri, infoHash, s.storageFor(dir))
 	if err != nil {
-		return fmt.Errorf("add magnet: %w", err)
+		return nil, fmt.Errorf("add magnet: %w", err)
 	}
 	defer t.Drop()
 
+	active.mu.Lock()
+	active.torrent = t
+	active.mu.Unlock()
+
 	select {
 	case <-t.GotInfo():
 	case <-time.After(MetadataTimeout):
-		return fmt.Errorf("timeout fetching metadata")
+		return nil, fmt.Errorf("timeout fetching metadata")
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	if len(t.Files()) == 0 {
-		return fmt.Errorf("torrent has no files")
+		return nil, fmt.Errorf("torrent has no files")
+	}
+
+	s.cacheMetadata(newTorrentDetails(t, nil, uri), t.Metainfo().InfoBytes)
+	if !transfer.Private {
+		s.saveTorrent(infoHash, t.Metainfo())
 	}
 
 	selectedSet := make(map[int]bool)
 	for _, idx := range selectedIndices {
 		if idx < 0 || idx >= len(t.Files()) {
-			return fmt.Errorf("invalid file index: %d (torrent has %d files)", idx, len(t.Files()))
+			return nil, fmt.Errorf("invalid file index: %d (torrent has %d files)", idx, len(t.Files()))
 		}
 		selectedSet[idx] = true
 	}
 
 	if len(selectedSet) == 0 {
-		return fmt.Errorf("no valid files selected")
+		return nil, fmt.Errorf("no valid files selected")
 	}
 
 	if len(selectedSet) != len(selectedIndices) {
-		return fmt.Errorf("duplicate file indices in selection")
+		return nil, fmt.Errorf("duplicate file indices in selection")
 	}
 
 	var totalSize int64
@@ -182,6 +396,23 @@ func (s *Service) Download(ctx context.Context, id string, magnetLink string, se
 		}
 	}
 
+	var remaining int64
+	for i, file := range t.Files() {
+		if selectedSet[i] {
+			remaining += file.Length() - file.BytesCompleted()
+		}
+	}
+	if err := s.waitForSpace(ctx, id, dir, remaining, reporter); err != nil {
+		return nil, err
+	}
+
+	if s.AllocationMode() == AllocationFull {
+		if err := s.preallocateFiles(t, dir, selectedSet); err != nil {
+			return nil, err
+		}
+		log.Printf("[Download] Preallocated %d selected files for ID=%s", len(selectedSet), id)
+	}
+
 	log.Printf("[Download] Starting download ID=%s: %d selected files out of %d total. Selected indices: %v", id, len(selectedSet), len(t.Files()), selectedFilesList)
 
 	for i, file := range t.Files() {
@@ -216,6 +447,9 @@ func (s *Service) Download(ctx context.Context, id string, magnetLink string, se
 		}
 	}
 
+	downThrottle := newThrottle(transfer.MaxDownloadSpeed)
+	upThrottle := newThrottle(transfer.MaxUploadSpeed)
+
 	ticker := time.NewTicker(ProgressInterval)
 	defer ticker.Stop()
 
@@ -225,13 +459,28 @@ func (s *Service) Download(ctx context.Context, id string, magnetLink string, se
 
 	for {
 		if err := pauseManager.WaitIfPaused(ctx); err != nil {
-			return err
+			return nil, err
 		}
 
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
+			return nil, ctx.Err()
+		case now := <-ticker.C:
+			applyThrottles(t, downThrottle, upThrottle, now)
+
+			for _, idx := range active.takePending() {
+				if idx < 0 || idx >= len(t.Files()) || selectedSet[idx] {
+					continue
+				}
+				file := t.Files()[idx]
+				selectedSet[idx] = true
+				selectedFilesList = append(selectedFilesList, idx)
+				totalSize += file.Length()
+				file.SetPriority(torrent.PiecePriorityNormal)
+				file.Download()
+				log.Printf("[Download] File %d (%s) - ADDED to running download %s", idx, file.Path(), id)
+			}
+
 			completedSize = 0
 			unselectedBytes := int64(0)
 			for i, file := range t.Files() {
@@ -247,7 +496,7 @@ func (s *Service) Download(ctx context.Context, id string, magnetLink string, se
 			}
 			
 			if unselectedBytes > 0 {
-				return fmt.Errorf("unselected files are being downloaded: %d bytes total from unselected files", unselectedBytes)
+				return nil, fmt.Errorf("unselected files are being downloaded: %d bytes total from unselected files", unselectedBytes)
 			}
 
 			if totalSize == 0 {
@@ -275,87 +524,149 @@ func (s *Service) Download(ctx context.Context, id string, magnetLink string, se
 					reporter.OnLog(id, "Completed")
 					reporter.OnProgress(id, 100, 0, 0)
 				}
-				return nil
+
+				if transfer.seeds() {
+					if downThrottle != nil {
+						t.AllowDataDownload()
+					}
+					if err := s.seed(ctx, id, t, totalSize, transfer, upThrottle, reporter); err != nil {
+						return nil, err
+					}
+				}
+
+				files := make([]string, 0, len(selectedFilesList))
+				for _, idx := range selectedFilesList {
+					files = append(files, t.Files()[idx].Path())
+				}
+				return &DownloadResult{
+					Name:      t.Name(),
+					InfoHash:  t.InfoHash().HexString(),
+					Dir:       dir,
+					TotalSize: totalSize,
+					Files:     files,
+				}, nil
 			}
 		}
 	}
 }
 
-func (s *Service) GetTorrentInfo(magnetLink string) ([]FileMetadata, string, error) {
-	if err := ValidateMagnetLink(magnetLink); err != nil {
-		return nil, "", err
-	}
-
-	t, err := s.client.AddMagnet(magnetLink)
+// addMagnet adiciona o magnet ao cliente reaproveitando o info dict em cache,
+// se houver, para não esperar os metadados dos peers. Com store, os dados
+// vão para ele em vez do armazenamento padrão.
+func (s *Service) addMagnet(uri, infoHash string, store storage.ClientImpl) (*torrent.Torrent, error) {
+	spec, err := torrent.TorrentSpecFromMagnetUri(uri)
 	if err != nil {
-		return nil, "", fmt.Errorf("add magnet: %w", err)
+		return nil, err
+	}
+	if store != nil {
+		spec.Storage = store
+		// Uma análise em andamento pode ter adicionado o torrent com o
+		// armazenamento padrão; o cliente reaproveitaria esse
+		if t, ok := s.client.Torrent(spec.InfoHash); ok {
+			t.Drop()
+		}
 	}
-	defer t.Drop()
-
-	select {
-	case <-t.GotInfo():
-	case <-time.After(MetadataTimeout):
-		t.Drop()
-		return nil, "", fmt.Errorf("timeout fetching metadata")
+	if infoBytes := s.cachedInfoBytes(infoHash); infoBytes != nil {
+		spec.InfoBytes = infoBytes
+	} else if infoBytes := s.storedInfoBytes(infoHash); infoBytes != nil {
+		spec.InfoBytes = infoBytes
 	}
+	t, _, err := s.client.AddTorrentSpec(spec)
+	return t, err
+}
 
-	files := make([]FileMetadata, 0, len(t.Files()))
-	for i, file := range t.Files() {
-		files = append(files, *NewFileMetadata(i, file.Path(), file.Length()))
-	}
+func (s *Service) registerActive(infoHash string) (*activeDownload, error) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
 
-	return files, t.Name(), nil
+	if _, exists := s.active[infoHash]; exists {
+		return nil, ErrAlreadyActive
+	}
+	active := &activeDownload{}
+	s.active[infoHash] = active
+	return active, nil
 }
 
-func (s *Service) AddTorrentFromFile(path string) ([]FileMetadata, string, string, error) {
-	t, err := s.client.AddTorrentFromFile(path)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("add torrent file: %w", err)
-	}
-	defer t.Drop()
+// IsActive indica se há um download em andamento para infoHash.
+func (s *Service) IsActive(infoHash string) bool {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	_, exists := s.active[infoHash]
+	return exists
+}
 
-	select {
-	case <-t.GotInfo():
-	case <-time.After(MetadataTimeout):
-		t.Drop()
-		return nil, "", "", fmt.Errorf("timeout fetching metadata")
-	}
+func (s *Service) unregisterActive(infoHash string) {
+	s.activeMu.Lock()
+	delete(s.active, infoHash)
+	s.activeMu.Unlock()
+}
 
-	files := make([]FileMetadata, 0, len(t.Files()))
-	for i, file := range t.Files() {
-		files = append(files, *NewFileMetadata(i, file.Path(), file.Length()))
+// AddToSelection inclui arquivos num download em andamento do mesmo torrent.
+// Índices fora do torrent só podem ser rejeitados depois dos metadados; até
+// lá eles são ignorados silenciosamente pelo laço de progresso.
+func (s *Service) AddToSelection(infoHash string, indices []int) error {
+	s.activeMu.Lock()
+	active, exists := s.active[infoHash]
+	s.activeMu.Unlock()
+	if !exists {
+		return ErrNotActive
+	}
+
+	active.mu.Lock()
+	defer active.mu.Unlock()
+
+	if active.torrent != nil && active.torrent.Info() != nil {
+		count := len(active.torrent.Files())
+		for _, idx := range indices {
+			if idx < 0 || idx >= count {
+				return fmt.Errorf("invalid file index: %d (torrent has %d files)", idx, count)
+			}
+		}
 	}
+	active.pending = append(active.pending, indices...)
+	return nil
+}
 
-	magnet := t.Metainfo().Magnet(nil, t.Info()).String()
-
-	return files, t.Name(), magnet, nil
+func (a *activeDownload) takePending() []int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pending := a.pending
+	a.pending = nil
+	return pending
 }
 
-func (s *Service) AddTorrentFromBytes(data []byte) ([]FileMetadata, string, string, error) {
-	mi, err := metainfo.Load(bytes.NewReader(data))
+func (s *Service) GetTorrentInfo(magnetLink string) ([]FileMetadata, string, error) {
+	details, err := s.AnalyzeMagnet(magnetLink)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("parse torrent data: %w", err)
+		return nil, "", err
 	}
+	return details.Files, details.Name, nil
+}
 
-	t, err := s.client.AddTorrent(mi)
+func (s *Service) AddTorrentFromFile(path string) ([]FileMetadata, string, string, error) {
+	mi, err := metainfo.LoadFromFile(path)
 	if err != nil {
-		return nil, "", "", fmt.Errorf("add torrent: %w", err)
+		return nil, "", "", fmt.Errorf("add torrent file: %w", err)
 	}
-	defer t.Drop()
 
-	select {
-	case <-t.GotInfo():
-	case <-time.After(MetadataTimeout):
-		t.Drop()
-		return nil, "", "", fmt.Errorf("timeout fetching metadata")
+	t, err := s.client.AddTorrent(mi)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("add torrent file: %w", err)
 	}
+	defer s.dropUnlessActive(t)
 
-	files := make([]FileMetadata, 0, len(t.Files()))
-	for i, file := range t.Files() {
-		files = append(files, *NewFileMetadata(i, file.Path(), file.Length()))
+	if err := waitForInfo(t); err != nil {
+		return nil, "", "", err
 	}
 
-	magnet := mi.Magnet(nil, t.Info()).String()
+	details := newTorrentDetails(t, mi, mi.Magnet(nil, t.Info()).String())
+	return details.Files, details.Name, details.MagnetLink, nil
+}
 
-	return files, t.Name(), magnet, nil
+func (s *Service) AddTorrentFromBytes(data []byte) ([]FileMetadata, string, string, error) {
+	details, err := s.AnalyzeTorrentBytes(data)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return details.Files, details.Name, details.MagnetLink, nil
 }
@@ -0,0 +1,196 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const StorageMemory = "memory"
+
+// StorageOptions escolhe onde os dados dos torrents são gravados e onde fica
+// o banco de conclusão de peças.
+type StorageOptions struct {
+	Backend string
+	// CompletionDir guarda o banco de peças concluídas. Com ele, reinícios
+	// não precisam verificar novamente os dados já baixados.
+	CompletionDir string
+	// TorrentDir guarda o .torrent de cada download iniciado (vazio desativa)
+	TorrentDir string
+}
+
+func ValidateStorageBackend(backend string) error {
+	switch backend {
+	case "", StorageFile, StorageMMap, StorageMemory:
+		return nil
+	default:
+		return fmt.Errorf("unknown storage backend: %q (use file, mmap or memory)", backend)
+	}
+}
+
+// newStorage cria o armazenamento padrão do cliente em dataDir. A conclusão
+// das peças retornada é compartilhada com os diretórios de newDirStorage
+// (nil no backend em memória).
+func newStorage(opts StorageOptions, dataDir string) (storage.ClientImplCloser, storage.PieceCompletion, string, error) {
+	backend := opts.Backend
+	if backend == "" {
+		backend = StorageFile
+	}
+	if err := ValidateStorageBackend(backend); err != nil {
+		return nil, nil, "", err
+	}
+
+	if backend == StorageMemory {
+		return newMemoryStorage(), nil, backend, nil
+	}
+
+	completion := openPieceCompletion(opts.CompletionDir, dataDir)
+	if backend == StorageMMap {
+		return storage.NewMMapWithCompletion(dataDir, completion), completion, backend, nil
+	}
+	return storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dataDir,
+		PieceCompletion: completion,
+	}), completion, backend, nil
+}
+
+// newDirStorage grava os torrents em dir, para downloads com diretório de
+// destino próprio. Usa a conclusão de peças do armazenamento padrão, que
+// continua responsável por fechá-la.
+func newDirStorage(backend, dir string, completion storage.PieceCompletion) storage.ClientImpl {
+	completion = sharedCompletion{completion}
+	if backend == StorageMMap {
+		return storage.NewMMapWithCompletion(dir, completion)
+	}
+	return storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: completion,
+	})
+}
+
+// sharedCompletion ignora Close; o banco é fechado pelo armazenamento padrão.
+type sharedCompletion struct {
+	storage.PieceCompletion
+}
+
+func (sharedCompletion) Close() error { return nil }
+
+func openPieceCompletion(dir, fallbackDir string) storage.PieceCompletion {
+	if dir == "" {
+		dir = fallbackDir
+	}
+	completion, err := storage.NewBoltPieceCompletion(dir)
+	if err != nil {
+		log.Printf("[Storage] WARNING: piece completion db unavailable in %s, falling back to memory: %v", dir, err)
+		return storage.NewMapPieceCompletion()
+	}
+	return completion
+}
+
+// memoryStorage mantém as peças em memória. Os dados se perdem ao fechar o
+// cliente, então é indicado apenas para análise e testes.
+type memoryStorage struct{}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{}
+}
+
+// OpenTorrent cria um torrent com mapa de conclusão próprio, que some junto
+// com as peças quando o torrent é fechado.
+func (m *memoryStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t := &memoryTorrent{
+		infoHash:   infoHash,
+		pieces:     make(map[int][]byte),
+		completion: storage.NewMapPieceCompletion(),
+	}
+	return storage.TorrentImpl{
+		Piece: t.piece,
+		Close: t.close,
+	}, nil
+}
+
+func (m *memoryStorage) Close() error {
+	return nil
+}
+
+type memoryTorrent struct {
+	infoHash   metainfo.Hash
+	pieces     map[int][]byte
+	completion storage.PieceCompletion
+	mu         sync.RWMutex
+}
+
+func (t *memoryTorrent) piece(p metainfo.Piece) storage.PieceImpl {
+	return &memoryPiece{t: t, index: p.Index(), length: p.Length()}
+}
+
+func (t *memoryTorrent) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for index := range t.pieces {
+		t.completion.Set(metainfo.PieceKey{InfoHash: t.infoHash, Index: index}, false)
+	}
+	t.pieces = make(map[int][]byte)
+	return nil
+}
+
+type memoryPiece struct {
+	t      *memoryTorrent
+	index  int
+	length int64
+}
+
+func (p *memoryPiece) key() metainfo.PieceKey {
+	return metainfo.PieceKey{InfoHash: p.t.infoHash, Index: p.index}
+}
+
+func (p *memoryPiece) ReadAt(b []byte, off int64) (int, error) {
+	p.t.mu.RLock()
+	defer p.t.mu.RUnlock()
+
+	data := p.t.pieces[p.index]
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (p *memoryPiece) WriteAt(b []byte, off int64) (int, error) {
+	if off+int64(len(b)) > p.length {
+		return 0, fmt.Errorf("write beyond piece %d length", p.index)
+	}
+
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+
+	data, ok := p.t.pieces[p.index]
+	if !ok {
+		data = make([]byte, p.length)
+		p.t.pieces[p.index] = data
+	}
+	return copy(data[off:], b), nil
+}
+
+func (p *memoryPiece) MarkComplete() error {
+	return p.t.completion.Set(p.key(), true)
+}
+
+func (p *memoryPiece) MarkNotComplete() error {
+	return p.t.completion.Set(p.key(), false)
+}
+
+func (p *memoryPiece) Completion() storage.Completion {
+	c, err := p.t.completion.Get(p.key())
+	if err != nil {
+		return storage.Completion{Err: err}
+	}
+	return c
+}
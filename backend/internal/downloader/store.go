@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Backends de persistência aceitos por OpenStore
+const (
+	StoreJSON   = "json"
+	StoreSQLite = "sqlite"
+)
+
+// Store guarda os registros do PersistenceManager. Cada escrita recebe só os
+// registros alterados; o PersistenceManager mantém a cópia em memória e
+// serializa as escritas.
+type Store interface {
+	// Load lê todos os registros na abertura.
+	Load() (*StoreData, error)
+
+	PutDownload(record *DownloadRecord) error
+	DeleteDownloads(ids ...string) error
+	// QueryDownloads retorna os downloads que atendem ao filtro, do mais
+	// recentemente atualizado para o mais antigo.
+	QueryDownloads(filter DownloadFilter) ([]*DownloadRecord, error)
+
+	PutHistory(records ...*HistoryRecord) error
+	DeleteHistory(ids ...int) error
+	QueryHistory(q HistoryQuery) ([]*HistoryRecord, int, error)
+
+	PutFavorites(records ...*FavoriteRecord) error
+	DeleteFavorites(ids ...int) error
+
+	Close() error
+}
+
+// StoreData são os registros lidos por Store.Load. Recovered lista os
+// arquivos corrompidos que foram restaurados de backup.
+type StoreData struct {
+	Downloads map[string]*DownloadRecord
+	History   []*HistoryRecord
+	Favorites []*FavoriteRecord
+	Recovered []RecoveryEvent
+}
+
+// DownloadFilter filtra downloads por status e info hash (vazio não filtra).
+type DownloadFilter struct {
+	Status   []string
+	InfoHash string
+}
+
+// ValidateStoreBackend verifica o nome do backend de persistência.
+func ValidateStoreBackend(backend string) error {
+	switch backend {
+	case StoreJSON, StoreSQLite:
+		return nil
+	default:
+		return fmt.Errorf("invalid persistence backend: %s", backend)
+	}
+}
+
+// OpenStore abre o backend escolhido em dir. O SQLite importa os arquivos
+// JSON existentes na primeira abertura.
+func OpenStore(backend, dir string) (Store, error) {
+	switch backend {
+	case "", StoreJSON:
+		return newJSONStore(dir), nil
+	case StoreSQLite:
+		return openSQLiteStore(dir)
+	default:
+		return nil, ValidateStoreBackend(backend)
+	}
+}
+
+func (f DownloadFilter) matches(r *DownloadRecord) bool {
+	if f.InfoHash != "" && r.InfoHash != f.InfoHash {
+		return false
+	}
+	if len(f.Status) == 0 {
+		return true
+	}
+	for _, s := range f.Status {
+		if r.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// filterHistory aplica a HistoryQuery em memória, para backends sem índice.
+func filterHistory(records []*HistoryRecord, q HistoryQuery) ([]*HistoryRecord, int) {
+	text := strings.ToLower(strings.TrimSpace(q.Text))
+	results := make([]*HistoryRecord, 0)
+	for _, r := range records {
+		if !q.From.IsZero() && r.AccessedAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && r.AccessedAt.After(q.To) {
+			continue
+		}
+		if text != "" && !historyContains(r, text) {
+			continue
+		}
+		results = append(results, r)
+	}
+
+	less := func(a, b *HistoryRecord) bool { return a.AccessedAt.Before(b.AccessedAt) }
+	switch q.Sort {
+	case HistorySortName:
+		less = func(a, b *HistoryRecord) bool {
+			return strings.ToLower(a.TorrentName) < strings.ToLower(b.TorrentName)
+		}
+	case HistorySortSize:
+		less = func(a, b *HistoryRecord) bool { return a.TotalSize < b.TotalSize }
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if q.Desc {
+			return less(results[j], results[i])
+		}
+		return less(results[i], results[j])
+	})
+
+	total := len(results)
+	if q.Offset >= total {
+		return []*HistoryRecord{}, total
+	}
+	results = results[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(results) {
+		results = results[:q.Limit]
+	}
+	return results, total
+}
+
+func historyContains(r *HistoryRecord, text string) bool {
+	return strings.Contains(strings.ToLower(r.TorrentName), text) ||
+		strings.Contains(strings.ToLower(r.MagnetLink), text) ||
+		strings.Contains(r.InfoHash, text)
+}
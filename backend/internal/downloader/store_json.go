@@ -0,0 +1,357 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"nebula/backend/internal/fileutil"
+)
+
+// jsonStore grava cada coleção em um arquivo JSON (downloads.json,
+// history.json e favorites.json). Histórico e favoritos são regravados a
+// cada alteração; downloads são agrupados e gravados após 2 segundos.
+type jsonStore struct {
+	downloadsPath string
+	historyPath   string
+	favoritesPath string
+	mu            sync.Mutex
+
+	downloads map[string]*DownloadRecord
+	history   map[int]*HistoryRecord
+	favorites map[int]*FavoriteRecord
+
+	saveTimer   *time.Timer
+	pendingSave bool
+	saveMu      sync.Mutex
+}
+
+func newJSONStore(dir string) *jsonStore {
+	return &jsonStore{
+		downloadsPath: filepath.Join(dir, "downloads.json"),
+		historyPath:   filepath.Join(dir, "history.json"),
+		favoritesPath: filepath.Join(dir, "favorites.json"),
+		downloads:     make(map[string]*DownloadRecord),
+		history:       make(map[int]*HistoryRecord),
+		favorites:     make(map[int]*FavoriteRecord),
+	}
+}
+
+func (s *jsonStore) Load() (*StoreData, error) {
+	data, err := s.readFiles(loadJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := migrateData(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, r := range data.Downloads {
+		copy := *r
+		s.downloads[id] = &copy
+	}
+	for _, r := range data.History {
+		s.history[r.ID] = r
+	}
+	for _, r := range data.Favorites {
+		s.favorites[r.ID] = r
+	}
+
+	if changed.downloads {
+		if err := rewriteMigrated(s.downloadsPath, s.downloads); err != nil {
+			return nil, fmt.Errorf("migrate downloads: %w", err)
+		}
+	}
+	if changed.history {
+		if err := rewriteMigrated(s.historyPath, s.sortedHistory()); err != nil {
+			return nil, fmt.Errorf("migrate history: %w", err)
+		}
+	}
+	if changed.favorites {
+		if err := rewriteMigrated(s.favoritesPath, s.sortedFavorites()); err != nil {
+			return nil, fmt.Errorf("migrate favorites: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// readFiles lê os três arquivos com read (loadJSON ou readJSON).
+func (s *jsonStore) readFiles(read func(path string, v interface{}) (*RecoveryEvent, error)) (*StoreData, error) {
+	data := &StoreData{
+		Downloads: make(map[string]*DownloadRecord),
+		History:   make([]*HistoryRecord, 0),
+		Favorites: make([]*FavoriteRecord, 0),
+	}
+
+	files := []struct {
+		name string
+		path string
+		v    interface{}
+	}{
+		{"downloads", s.downloadsPath, &data.Downloads},
+		{"history", s.historyPath, &data.History},
+		{"favorites", s.favoritesPath, &data.Favorites},
+	}
+	for _, f := range files {
+		event, err := read(f.path, f.v)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", f.name, err)
+		}
+		if event != nil {
+			data.Recovered = append(data.Recovered, *event)
+		}
+	}
+	return data, nil
+}
+
+func (s *jsonStore) PutDownload(record *DownloadRecord) error {
+	copy := *record
+	s.mu.Lock()
+	s.downloads[record.ID] = &copy
+	s.mu.Unlock()
+
+	s.scheduleSave()
+	return nil
+}
+
+func (s *jsonStore) DeleteDownloads(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		delete(s.downloads, id)
+	}
+	return saveJSON(s.downloadsPath, s.downloads)
+}
+
+func (s *jsonStore) QueryDownloads(filter DownloadFilter) ([]*DownloadRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []*DownloadRecord
+	for _, r := range s.downloads {
+		if filter.matches(r) {
+			copy := *r
+			results = append(results, &copy)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+	return results, nil
+}
+
+func (s *jsonStore) scheduleSave() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.pendingSave = true
+
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+	}
+
+	s.saveTimer = time.AfterFunc(2*time.Second, func() {
+		s.saveMu.Lock()
+		if !s.pendingSave {
+			s.saveMu.Unlock()
+			return
+		}
+		s.pendingSave = false
+		s.saveMu.Unlock()
+
+		s.mu.Lock()
+		saveJSON(s.downloadsPath, s.downloads)
+		s.mu.Unlock()
+	})
+}
+
+func (s *jsonStore) PutHistory(records ...*HistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range records {
+		s.history[r.ID] = r
+	}
+	return saveJSON(s.historyPath, s.sortedHistory())
+}
+
+func (s *jsonStore) DeleteHistory(ids ...int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		delete(s.history, id)
+	}
+	return saveJSON(s.historyPath, s.sortedHistory())
+}
+
+func (s *jsonStore) QueryHistory(q HistoryQuery) ([]*HistoryRecord, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, total := filterHistory(s.sortedHistory(), q)
+	return records, total, nil
+}
+
+func (s *jsonStore) PutFavorites(records ...*FavoriteRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range records {
+		s.favorites[r.ID] = r
+	}
+	return saveJSON(s.favoritesPath, s.sortedFavorites())
+}
+
+func (s *jsonStore) DeleteFavorites(ids ...int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		delete(s.favorites, id)
+	}
+	return saveJSON(s.favoritesPath, s.sortedFavorites())
+}
+
+func (s *jsonStore) Close() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+	}
+	if !s.pendingSave {
+		return nil
+	}
+	s.pendingSave = false
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return saveJSON(s.downloadsPath, s.downloads)
+}
+
+func (s *jsonStore) sortedHistory() []*HistoryRecord {
+	records := make([]*HistoryRecord, 0, len(s.history))
+	for _, r := range s.history {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
+func (s *jsonStore) sortedFavorites() []*FavoriteRecord {
+	records := make([]*FavoriteRecord, 0, len(s.favorites))
+	for _, r := range s.favorites {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
+// migratedCollections indica quais coleções migrateData alterou.
+type migratedCollections struct {
+	downloads bool
+	history   bool
+	favorites bool
+}
+
+// migrateData preenche o info hash dos registros gravados antes da chave
+// canônica e junta duplicatas do mesmo torrent.
+func migrateData(data *StoreData) migratedCollections {
+	var changed migratedCollections
+
+	for _, r := range data.Downloads {
+		if r.InfoHash == "" {
+			r.InfoHash = infoHashKey(r.MagnetLink)
+			changed.downloads = true
+		}
+	}
+
+	history := make([]*HistoryRecord, 0, len(data.History))
+	historyIndex := make(map[string]*HistoryRecord)
+	for _, r := range data.History {
+		key := infoHashKey(r.MagnetLink)
+		if r.InfoHash != key {
+			r.InfoHash = key
+			changed.history = true
+		}
+		existing, ok := historyIndex[key]
+		if !ok {
+			historyIndex[key] = r
+			history = append(history, r)
+			continue
+		}
+		changed.history = true
+		if r.AccessedAt.After(existing.AccessedAt) {
+			existing.AccessedAt = r.AccessedAt
+			existing.FileCount = r.FileCount
+			existing.TotalSize = r.TotalSize
+		}
+	}
+
+	favorites := make([]*FavoriteRecord, 0, len(data.Favorites))
+	favoriteIndex := make(map[string]*FavoriteRecord)
+	for _, r := range data.Favorites {
+		key := infoHashKey(r.MagnetLink)
+		if r.InfoHash != key {
+			r.InfoHash = key
+			changed.favorites = true
+		}
+		existing, ok := favoriteIndex[key]
+		if !ok {
+			favoriteIndex[key] = r
+			favorites = append(favorites, r)
+			continue
+		}
+		changed.favorites = true
+		existing.Tags = mergeTags(existing.Tags, r.Tags)
+		if r.Notes != "" && r.Notes != existing.Notes {
+			if existing.Notes != "" {
+				existing.Notes += "\n"
+			}
+			existing.Notes += r.Notes
+		}
+		if r.AddedAt.Before(existing.AddedAt) {
+			existing.AddedAt = r.AddedAt
+		}
+		if r.UpdatedAt.After(existing.UpdatedAt) {
+			existing.UpdatedAt = r.UpdatedAt
+		}
+	}
+
+	data.History = history
+	data.Favorites = favorites
+	return changed
+}
+
+// rewriteMigrated grava a versão migrada mantendo o arquivo original com a
+// extensão .bak.
+func rewriteMigrated(path string, v interface{}) error {
+	if data, err := os.ReadFile(path); err == nil {
+		backup := path + ".bak"
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			if err := fileutil.WriteFileAtomic(backup, data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return saveJSON(path, v)
+}
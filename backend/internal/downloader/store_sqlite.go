@@ -0,0 +1,452 @@
+package downloader
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations são aplicadas em ordem; PRAGMA user_version guarda
+// quantas já rodaram. Nunca altere uma migração publicada, acrescente outra.
+var sqliteMigrations = []string{
+	// 1: esquema inicial
+	`CREATE TABLE downloads (
+		id         TEXT PRIMARY KEY,
+		info_hash  TEXT NOT NULL DEFAULT '',
+		status     TEXT NOT NULL DEFAULT '',
+		updated_at INTEGER NOT NULL DEFAULT 0,
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX idx_downloads_status ON downloads(status, updated_at);
+	CREATE INDEX idx_downloads_info_hash ON downloads(info_hash);
+
+	CREATE TABLE history (
+		id           INTEGER PRIMARY KEY,
+		info_hash    TEXT NOT NULL UNIQUE,
+		magnet_link  TEXT NOT NULL,
+		torrent_name TEXT NOT NULL DEFAULT '',
+		file_count   INTEGER NOT NULL DEFAULT 0,
+		total_size   INTEGER NOT NULL DEFAULT 0,
+		accessed_at  INTEGER NOT NULL
+	);
+	CREATE INDEX idx_history_accessed_at ON history(accessed_at);
+	CREATE INDEX idx_history_name ON history(torrent_name COLLATE NOCASE);
+	CREATE INDEX idx_history_size ON history(total_size);
+
+	CREATE TABLE favorites (
+		id        INTEGER PRIMARY KEY,
+		info_hash TEXT NOT NULL UNIQUE,
+		added_at  INTEGER NOT NULL,
+		data      TEXT NOT NULL
+	);`,
+	// 2: índice de texto do histórico. O tokenizador trigram permite busca
+	// por trecho, como o LIKE '%...%' que substitui, usando o índice
+	`CREATE VIRTUAL TABLE history_fts USING fts5(
+		torrent_name, magnet_link, info_hash,
+		content = 'history', content_rowid = 'id', tokenize = 'trigram'
+	);
+	CREATE TRIGGER history_fts_insert AFTER INSERT ON history BEGIN
+		INSERT INTO history_fts(rowid, torrent_name, magnet_link, info_hash)
+		VALUES (new.id, new.torrent_name, new.magnet_link, new.info_hash);
+	END;
+	CREATE TRIGGER history_fts_delete AFTER DELETE ON history BEGIN
+		INSERT INTO history_fts(history_fts, rowid, torrent_name, magnet_link, info_hash)
+		VALUES ('delete', old.id, old.torrent_name, old.magnet_link, old.info_hash);
+	END;
+	CREATE TRIGGER history_fts_update AFTER UPDATE ON history BEGIN
+		INSERT INTO history_fts(history_fts, rowid, torrent_name, magnet_link, info_hash)
+		VALUES ('delete', old.id, old.torrent_name, old.magnet_link, old.info_hash);
+		INSERT INTO history_fts(rowid, torrent_name, magnet_link, info_hash)
+		VALUES (new.id, new.torrent_name, new.magnet_link, new.info_hash);
+	END;
+	INSERT INTO history_fts(history_fts) VALUES ('rebuild');`,
+}
+
+// sqliteStore guarda os registros em nebula.db. Downloads e favoritos ficam
+// como JSON na coluna data, com as colunas consultadas indexadas ao lado;
+// o histórico usa uma coluna por campo para busca e ordenação.
+type sqliteStore struct {
+	db  *sql.DB
+	dir string
+
+	// recovered são os arquivos JSON restaurados de backup na importação
+	recovered []RecoveryEvent
+}
+
+func openSQLiteStore(dir string) (*sqliteStore, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	dsn := "file:" + filepath.ToSlash(filepath.Join(dir, "nebula.db")) + "?" + params.Encode()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	// Uma conexão serializa as escritas e evita SQLITE_BUSY entre conexões
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteStore{db: db, dir: dir}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate aplica as migrações pendentes, cada uma em sua transação. A
+// importação dos arquivos JSON faz parte da migração 1: se falhar, o banco
+// continua vazio e a importação é refeita na próxima abertura.
+func (s *sqliteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than supported (%d)", version, len(sqliteMigrations))
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		if err := s.runMigration(i); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) runMigration(i int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+		return err
+	}
+	if i == 0 {
+		if err := s.importJSON(tx); err != nil {
+			return fmt.Errorf("import json files: %w", err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// importJSON copia downloads.json, history.json e favorites.json para o
+// banco recém-criado. Os arquivos não são alterados: corrompidos são lidos
+// do backup e migrações de formato só são aplicadas aos registros copiados.
+func (s *sqliteStore) importJSON(tx *sql.Tx) error {
+	data, err := newJSONStore(s.dir).readFiles(readJSON)
+	if err != nil {
+		return err
+	}
+	migrateData(data)
+	s.recovered = data.Recovered
+
+	for _, r := range data.Downloads {
+		if err := putDownload(tx, r); err != nil {
+			return err
+		}
+	}
+	for _, r := range data.History {
+		if err := putHistory(tx, r); err != nil {
+			return err
+		}
+	}
+	for _, r := range data.Favorites {
+		if err := putFavorite(tx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) Load() (*StoreData, error) {
+	data := &StoreData{
+		Downloads: make(map[string]*DownloadRecord),
+		History:   make([]*HistoryRecord, 0),
+		Favorites: make([]*FavoriteRecord, 0),
+		Recovered: s.recovered,
+	}
+
+	downloads, err := s.QueryDownloads(DownloadFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("load downloads: %w", err)
+	}
+	for _, r := range downloads {
+		data.Downloads[r.ID] = r
+	}
+
+	rows, err := s.db.Query("SELECT " + historyColumns + " FROM history ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("load history: %w", err)
+	}
+	data.History, err = scanHistory(rows)
+	if err != nil {
+		return nil, fmt.Errorf("load history: %w", err)
+	}
+
+	rows, err = s.db.Query("SELECT data FROM favorites ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("load favorites: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("load favorites: %w", err)
+		}
+		var r FavoriteRecord
+		if err := json.Unmarshal([]byte(raw), &r); err != nil {
+			return nil, fmt.Errorf("load favorites: %w", err)
+		}
+		data.Favorites = append(data.Favorites, &r)
+	}
+	return data, rows.Err()
+}
+
+// execer é satisfeito por *sql.DB e *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func putDownload(db execer, r *DownloadRecord) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO downloads (id, info_hash, status, updated_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET info_hash = excluded.info_hash, status = excluded.status,
+		updated_at = excluded.updated_at, data = excluded.data`,
+		r.ID, r.InfoHash, r.Status, r.UpdatedAt.UnixNano(), string(raw))
+	return err
+}
+
+func (s *sqliteStore) PutDownload(record *DownloadRecord) error {
+	return putDownload(s.db, record)
+}
+
+func (s *sqliteStore) DeleteDownloads(ids ...string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("DELETE FROM downloads WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) QueryDownloads(filter DownloadFilter) ([]*DownloadRecord, error) {
+	var where []string
+	var args []interface{}
+	if len(filter.Status) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(filter.Status)-1)+")")
+		for _, st := range filter.Status {
+			args = append(args, st)
+		}
+	}
+	if filter.InfoHash != "" {
+		where = append(where, "info_hash = ?")
+		args = append(args, filter.InfoHash)
+	}
+
+	query := "SELECT data FROM downloads"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY updated_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*DownloadRecord
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var r DownloadRecord
+		if err := json.Unmarshal([]byte(raw), &r); err != nil {
+			return nil, err
+		}
+		results = append(results, &r)
+	}
+	return results, rows.Err()
+}
+
+const historyColumns = "id, info_hash, magnet_link, torrent_name, file_count, total_size, accessed_at"
+
+func putHistory(db execer, r *HistoryRecord) error {
+	_, err := db.Exec(`INSERT INTO history (`+historyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET info_hash = excluded.info_hash, magnet_link = excluded.magnet_link,
+		torrent_name = excluded.torrent_name, file_count = excluded.file_count,
+		total_size = excluded.total_size, accessed_at = excluded.accessed_at`,
+		r.ID, r.InfoHash, r.MagnetLink, r.TorrentName, r.FileCount, r.TotalSize, r.AccessedAt.UnixNano())
+	return err
+}
+
+func scanHistory(rows *sql.Rows) ([]*HistoryRecord, error) {
+	defer rows.Close()
+
+	records := make([]*HistoryRecord, 0)
+	for rows.Next() {
+		var r HistoryRecord
+		var accessed int64
+		if err := rows.Scan(&r.ID, &r.InfoHash, &r.MagnetLink, &r.TorrentName, &r.FileCount, &r.TotalSize, &accessed); err != nil {
+			return nil, err
+		}
+		r.AccessedAt = time.Unix(0, accessed)
+		records = append(records, &r)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteStore) PutHistory(records ...*HistoryRecord) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, r := range records {
+			if err := putHistory(tx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) DeleteHistory(ids ...int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("DELETE FROM history WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+var historySortColumns = map[string]string{
+	HistorySortAccessed: "accessed_at",
+	HistorySortName:     "torrent_name COLLATE NOCASE",
+	HistorySortSize:     "total_size",
+}
+
+func (s *sqliteStore) QueryHistory(q HistoryQuery) ([]*HistoryRecord, int, error) {
+	var where []string
+	var args []interface{}
+	if !q.From.IsZero() {
+		where = append(where, "accessed_at >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "accessed_at <= ?")
+		args = append(args, q.To.UnixNano())
+	}
+	if text := strings.TrimSpace(q.Text); utf8.RuneCountInString(text) >= 3 {
+		where = append(where, "id IN (SELECT rowid FROM history_fts WHERE history_fts MATCH ?)")
+		args = append(args, `"`+strings.ReplaceAll(text, `"`, `""`)+`"`)
+	} else if text != "" {
+		// Trechos com menos de três caracteres não formam trigramas
+		pattern := "%" + escapeLike(text) + "%"
+		where = append(where, `(torrent_name LIKE ? ESCAPE '\' OR magnet_link LIKE ? ESCAPE '\' OR info_hash LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM history"+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := historySortColumns[q.Sort]
+	if !ok {
+		column = historySortColumns[HistorySortAccessed]
+	}
+	order := "ASC"
+	if q.Desc {
+		order = "DESC"
+	}
+	limit := -1
+	if q.Limit > 0 {
+		limit = q.Limit
+	}
+
+	rows, err := s.db.Query(
+		fmt.Sprintf("SELECT %s FROM history%s ORDER BY %s %s, id %s LIMIT ? OFFSET ?", historyColumns, filter, column, order, order),
+		append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	records, err := scanHistory(rows)
+	return records, total, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func putFavorite(db execer, r *FavoriteRecord) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO favorites (id, info_hash, added_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET info_hash = excluded.info_hash, added_at = excluded.added_at, data = excluded.data`,
+		r.ID, r.InfoHash, r.AddedAt.UnixNano(), string(raw))
+	return err
+}
+
+func (s *sqliteStore) PutFavorites(records ...*FavoriteRecord) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, r := range records {
+			if err := putFavorite(tx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) DeleteFavorites(ids ...int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("DELETE FROM favorites WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+
+	"nebula/backend/internal/fileutil"
+)
+
+var infoHashPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// StoredTorrent é um .torrent guardado em StorageOptions.TorrentDir.
+type StoredTorrent struct {
+	InfoHash string
+	Data     []byte
+}
+
+// ValidateTorrentFile verifica se data é um .torrent válido para infoHash.
+func ValidateTorrentFile(infoHash string, data []byte) error {
+	if !infoHashPattern.MatchString(infoHash) {
+		return fmt.Errorf("invalid info hash: %q", infoHash)
+	}
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("parse torrent %s: %w", infoHash, err)
+	}
+	if len(infoHash) == 40 && mi.HashInfoBytes().HexString() != infoHash {
+		return fmt.Errorf("torrent %s: info hash does not match", infoHash)
+	}
+	return nil
+}
+
+func (s *Service) torrentPath(infoHash string) string {
+	return filepath.Join(s.torrentDir, infoHash+".torrent")
+}
+
+// saveTorrent guarda o metainfo de um download, para que ele seja retomado
+// sem esperar os metadados dos peers e entre nos backups.
+func (s *Service) saveTorrent(infoHash string, mi metainfo.MetaInfo) {
+	if s.torrentDir == "" || !infoHashPattern.MatchString(infoHash) {
+		return
+	}
+	path := s.torrentPath(infoHash)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		log.Printf("[Service] WARNING: could not encode torrent %s: %v", infoHash, err)
+		return
+	}
+	if err := os.MkdirAll(s.torrentDir, 0755); err != nil {
+		log.Printf("[Service] WARNING: could not create torrent dir: %v", err)
+		return
+	}
+	if err := fileutil.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		log.Printf("[Service] WARNING: could not save torrent %s: %v", infoHash, err)
+	}
+}
+
+// storedInfoBytes retorna o info dict do .torrent guardado, ou nil.
+func (s *Service) storedInfoBytes(infoHash string) []byte {
+	if s.torrentDir == "" || !infoHashPattern.MatchString(infoHash) {
+		return nil
+	}
+	mi, err := metainfo.LoadFromFile(s.torrentPath(infoHash))
+	if err != nil {
+		return nil
+	}
+	return mi.InfoBytes
+}
+
+// RemoveTorrent apaga o .torrent guardado de infoHash, se houver.
+func (s *Service) RemoveTorrent(infoHash string) error {
+	if s.torrentDir == "" || !infoHashPattern.MatchString(infoHash) {
+		return nil
+	}
+	if err := os.Remove(s.torrentPath(infoHash)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// StoredTorrents lista os .torrent guardados, ordenados pelo info hash.
+func (s *Service) StoredTorrents() ([]StoredTorrent, error) {
+	if s.torrentDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.torrentDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var torrents []StoredTorrent
+	for _, e := range entries {
+		infoHash := strings.TrimSuffix(e.Name(), ".torrent")
+		if e.IsDir() || infoHash == e.Name() || !infoHashPattern.MatchString(infoHash) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.torrentDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		torrents = append(torrents, StoredTorrent{InfoHash: infoHash, Data: data})
+	}
+	sort.Slice(torrents, func(i, j int) bool { return torrents[i].InfoHash < torrents[j].InfoHash })
+	return torrents, nil
+}
+
+// StoreTorrent guarda um .torrent validado com ValidateTorrentFile. Sem
+// overwrite um arquivo existente é mantido. Retorna se o arquivo foi gravado.
+func (s *Service) StoreTorrent(t StoredTorrent, overwrite bool) (bool, error) {
+	if s.torrentDir == "" {
+		return false, fmt.Errorf("torrent storage disabled")
+	}
+	if err := ValidateTorrentFile(t.InfoHash, t.Data); err != nil {
+		return false, err
+	}
+	path := s.torrentPath(t.InfoHash)
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return false, nil
+		}
+	}
+	if err := os.MkdirAll(s.torrentDir, 0755); err != nil {
+		return false, err
+	}
+	if err := fileutil.WriteFileAtomic(path, t.Data, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
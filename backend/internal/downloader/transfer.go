@@ -0,0 +1,148 @@
+package downloader
+
+import (
+	"context"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// throttleWindow é o intervalo em que a taxa média de um torrent é medida.
+const throttleWindow = 10 * time.Second
+
+// TransferOptions ajusta um download individual. Velocidades em KB/s, como
+// em AppConfig; 0 mantém apenas os limites globais. O seeding termina quando
+// qualquer uma das metas preenchidas é atingida.
+type TransferOptions struct {
+	MaxDownloadSpeed int64   `json:"max_download_speed,omitempty"`
+	MaxUploadSpeed   int64   `json:"max_upload_speed,omitempty"`
+	SeedRatio        float64 `json:"seed_ratio,omitempty"`
+	SeedTime         int     `json:"seed_time,omitempty"` // minutos
+
+	// Private não guarda o .torrent do download em TorrentDir.
+	Private bool `json:"-"`
+
+	// OnSeeding é chamado quando o download termina e o seeding começa.
+	OnSeeding func() `json:"-"`
+}
+
+// IsZero indica que o download usa apenas os limites globais e não semeia.
+func (o TransferOptions) IsZero() bool {
+	return o.MaxDownloadSpeed == 0 && o.MaxUploadSpeed == 0 && !o.seeds()
+}
+
+func (o TransferOptions) seeds() bool {
+	return o.SeedRatio > 0 || o.SeedTime > 0
+}
+
+// throttle aproxima um limite de velocidade por torrent suspendendo a troca
+// de dados quando o volume da janela atual passa do permitido. O cliente só
+// oferece limitadores globais.
+type throttle struct {
+	limit       int64 // bytes/s
+	windowStart time.Time
+	windowBase  int64
+	blocked     bool
+}
+
+func newThrottle(kbps int64) *throttle {
+	if kbps <= 0 {
+		return nil
+	}
+	return &throttle{limit: kbps * 1024, windowBase: -1}
+}
+
+// update recebe o total transferido e informa se a troca deve ficar
+// suspensa e se isso mudou desde a última chamada.
+func (th *throttle) update(total int64, now time.Time) (blocked, changed bool) {
+	if th.windowBase < 0 || now.Sub(th.windowStart) >= throttleWindow {
+		th.windowStart = now
+		th.windowBase = total
+	}
+
+	allowed := int64(now.Sub(th.windowStart).Seconds()*float64(th.limit)) + th.limit
+	block := total-th.windowBase > allowed
+	changed = block != th.blocked
+	th.blocked = block
+	return block, changed
+}
+
+func applyThrottles(t *torrent.Torrent, down, up *throttle, now time.Time) {
+	stats := t.Stats()
+	if down != nil {
+		if blocked, changed := down.update(stats.BytesReadUsefulData.Int64(), now); changed {
+			if blocked {
+				t.DisallowDataDownload()
+			} else {
+				t.AllowDataDownload()
+			}
+		}
+	}
+	if up != nil {
+		if blocked, changed := up.update(stats.BytesWrittenData.Int64(), now); changed {
+			if blocked {
+				t.DisallowDataUpload()
+			} else {
+				t.AllowDataUpload()
+			}
+		}
+	}
+}
+
+// seed mantém o torrent compartilhando até atingir a meta de ratio (enviado
+// desde que o torrent foi adicionado sobre o tamanho selecionado) ou tempo.
+// Interromper o seeding pelo ctx não é erro: os dados já estão completos.
+func (s *Service) seed(ctx context.Context, id string, t *torrent.Torrent, totalSize int64, opts TransferOptions, up *throttle, reporter ProgressReporter) error {
+	if opts.OnSeeding != nil {
+		opts.OnSeeding()
+	}
+	if reporter != nil {
+		reporter.OnLog(id, "Seeding")
+	}
+
+	start := time.Now()
+	stats := t.Stats()
+	lastUploaded := stats.BytesWrittenData.Int64()
+
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if reporter != nil {
+				reporter.OnLog(id, "Seeding stopped")
+			}
+			return nil
+		case now := <-ticker.C:
+			applyThrottles(t, nil, up, now)
+
+			stats := t.Stats()
+			uploaded := stats.BytesWrittenData.Int64()
+			uploadSpeed := float64(uploaded-lastUploaded) / ProgressInterval.Seconds()
+			lastUploaded = uploaded
+
+			var ratio float64
+			if totalSize > 0 {
+				ratio = float64(uploaded) / float64(totalSize)
+			}
+			elapsed := now.Sub(start)
+
+			if reporter != nil {
+				reporter.OnProgress(id, 100, 0, uploadSpeed)
+				reporter.OnEvent(id, "seeding", map[string]interface{}{
+					"ratio":    ratio,
+					"uploaded": uploaded,
+					"elapsed":  int(elapsed.Seconds()),
+				})
+			}
+
+			if opts.SeedRatio > 0 && ratio >= opts.SeedRatio {
+				return nil
+			}
+			if opts.SeedTime > 0 && elapsed >= time.Duration(opts.SeedTime)*time.Minute {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DiskUsage descreve o espaço do volume que contém um diretório.
+type DiskUsage struct {
+	Free  int64 `json:"free"`
+	Total int64 `json:"total"`
+}
+
+// FreeSpace retorna o espaço disponível para o usuário no volume de path.
+// Se path ainda não existir, usa o primeiro diretório ancestral existente.
+func FreeSpace(path string) (*DiskUsage, error) {
+	dir, err := existingAncestor(path)
+	if err != nil {
+		return nil, err
+	}
+	return diskUsage(dir)
+}
+
+func existingAncestor(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package fileutil
+
+import "syscall"
+
+func diskUsage(dir string) (*DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return nil, err
+	}
+	return &DiskUsage{
+		Free:  int64(st.Bavail) * int64(st.Bsize),
+		Total: int64(st.Blocks) * int64(st.Bsize),
+	}, nil
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package fileutil
+
+import "golang.org/x/sys/windows"
+
+func diskUsage(dir string) (*DiskUsage, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return nil, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, &total, &totalFree); err != nil {
+		return nil, err
+	}
+	return &DiskUsage{
+		Free:  int64(free),
+		Total: int64(total),
+	}, nil
+}
@@ -0,0 +1,52 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PreallocateFile reserva size bytes em disco para path, criando o arquivo
+// se necessário. Dados já gravados são preservados.
+func PreallocateFile(path string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := allocate(f, size); err != nil {
+		f.Close()
+		return fmt.Errorf("preallocate %s: %w", filepath.Base(path), err)
+	}
+	return f.Close()
+}
+
+// zeroFill grava zeros do fim atual do arquivo até size. É o fallback nas
+// plataformas sem uma chamada de alocação nativa.
+func zeroFill(f *os.File, size int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<20)
+	for off := info.Size(); off < size; {
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		if _, err := f.WriteAt(buf[:n], off); err != nil {
+			return err
+		}
+		off += n
+	}
+	return nil
+}
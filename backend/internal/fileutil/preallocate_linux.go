@@ -0,0 +1,16 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func allocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		// Sistemas de arquivos sem fallocate (ex.: alguns FUSE)
+		return zeroFill(f, size)
+	}
+	return err
+}
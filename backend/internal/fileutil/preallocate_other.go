@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package fileutil
+
+import "os"
+
+func allocate(f *os.File, size int64) error {
+	return zeroFill(f, size)
+}
@@ -0,0 +1,32 @@
+package fileutil
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func allocate(f *os.File, size int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() >= size {
+		return nil
+	}
+
+	// FILE_ALLOCATION_INFO reserva os clusters sem preencher com zeros;
+	// Truncate ajusta o fim do arquivo para o tamanho final.
+	allocationSize := size
+	err = windows.SetFileInformationByHandle(
+		windows.Handle(f.Fd()),
+		windows.FileAllocationInfo,
+		(*byte)(unsafe.Pointer(&allocationSize)),
+		uint32(unsafe.Sizeof(allocationSize)),
+	)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(size)
+}
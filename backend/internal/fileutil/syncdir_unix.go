@@ -0,0 +1,15 @@
+//go:build !windows
+
+package fileutil
+
+import "os"
+
+// syncDir grava no disco a entrada de diretório criada pelo rename.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package fileutil
+
+// syncDir não se aplica no Windows: diretórios não podem ser abertos para
+// fsync e o rename já é gravado pelo NTFS.
+func syncDir(dir string) error {
+	return nil
+}
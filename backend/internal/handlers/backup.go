@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nebula/backend/internal/api"
+	"nebula/backend/internal/backup"
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/logger"
+	"nebula/backend/internal/middleware"
+)
+
+const maxRestoreSize = 512 << 20
+
+// Modos aceitos por HandleRestore
+const (
+	restoreMerge   = "merge"
+	restoreReplace = "replace"
+)
+
+// BackupHandler gera e restaura backups completos dos dados da aplicação
+type BackupHandler struct {
+	deps *Dependencies
+}
+
+func NewBackupHandler(deps *Dependencies) *BackupHandler {
+	return &BackupHandler{deps: deps}
+}
+
+type restoreResponse struct {
+	Mode     string          `json:"mode"`
+	DryRun   bool            `json:"dry_run"`
+	Manifest backup.Manifest `json:"manifest"`
+	downloader.RestoreResult
+	Torrents       int  `json:"torrents"`
+	ConfigRestored bool `json:"config_restored"`
+	APIKeyRestored bool `json:"api_key_restored"`
+	// RestartRequired indica que o backend de armazenamento ou de
+	// persistência mudou e só vale ao reiniciar
+	RestartRequired bool `json:"restart_required"`
+}
+
+// HandleBackup gera um zip com configuração, downloads, histórico, favoritos
+// e arquivos .torrent. A configuração é a do arquivo, sem flags e variáveis
+// de ambiente. A API key só é incluída com ?include_api_key=true
+func (h *BackupHandler) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	includeKey, _ := strconv.ParseBool(r.URL.Query().Get("include_api_key"))
+
+	torrents, err := h.deps.TorrentService.StoredTorrents()
+	if err != nil {
+		logger.Error("failed to read stored torrents: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to read stored torrents")
+		return
+	}
+
+	archive := &backup.Archive{
+		Config:   h.deps.ConfigManager.Stored(),
+		Data:     h.deps.Persistence.Snapshot(),
+		Torrents: torrents,
+	}
+	if includeKey {
+		archive.APIKey = middleware.GetAPIKey()
+	}
+
+	var buf bytes.Buffer
+	if err := backup.Write(&buf, archive); err != nil {
+		logger.Error("failed to create backup: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+
+	filename := fmt.Sprintf("nebula-backup-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleRestore valida um backup e o restaura. ?mode=merge (padrão) junta os
+// registros aos existentes e mantém a configuração; ?mode=replace substitui
+// tudo, inclusive a configuração e a API key quando presente. Com
+// ?dry_run=true apenas valida
+func (h *BackupHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = restoreMerge
+	}
+	if mode != restoreMerge && mode != restoreReplace {
+		api.RespondWithError(w, http.StatusBadRequest, "mode must be merge or replace")
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	data, err := readRestoreBody(w, r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	archive, err := backup.Read(data)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := restoreResponse{Mode: mode, DryRun: dryRun, Manifest: archive.Manifest}
+	if dryRun {
+		api.RespondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	replace := mode == restoreReplace
+	if replace && len(h.deps.DownloadManager.ActiveIDs()) > 0 {
+		api.RespondWithError(w, http.StatusConflict, "stop active downloads before restoring with mode=replace")
+		return
+	}
+
+	result, err := h.deps.Persistence.Restore(archive.Data, replace)
+	if err != nil {
+		logger.Error("failed to restore records: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to restore records")
+		return
+	}
+	resp.RestoreResult = *result
+
+	for _, t := range archive.Torrents {
+		written, err := h.deps.TorrentService.StoreTorrent(t, replace)
+		if err != nil {
+			logger.Error("failed to restore torrent %s: %v", t.InfoHash, err)
+			api.RespondWithError(w, http.StatusInternalServerError, "failed to restore torrent files")
+			return
+		}
+		if written {
+			resp.Torrents++
+		}
+	}
+
+	if replace {
+		current := h.deps.ConfigManager.Get()
+		resp.RestartRequired = archive.Config.StorageBackend != current.StorageBackend ||
+			archive.Config.PersistenceBackend != current.PersistenceBackend
+		if err := h.deps.ConfigManager.Replace(archive.Config); err != nil {
+			logger.Error("failed to restore config: %v", err)
+			api.RespondWithError(w, http.StatusInternalServerError, "failed to restore config")
+			return
+		}
+		resp.ConfigRestored = true
+
+		if archive.APIKey != "" {
+			if err := middleware.SetAPIKey(h.deps.AppDataDir, archive.APIKey); err != nil {
+				logger.Error("failed to restore api key: %v", err)
+				api.RespondWithError(w, http.StatusInternalServerError, "failed to restore api key")
+				return
+			}
+			resp.APIKeyRestored = true
+		}
+	}
+
+	logger.Info("backup restored (mode=%s, version=%d)", mode, archive.Manifest.Version)
+	api.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// readRestoreBody lê o zip do campo "file" de um multipart ou do corpo.
+func readRestoreBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreSize)
+
+	var body io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, fmt.Errorf("failed to parse multipart form: %v", err)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("file is required")
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("backup archive is required")
+	}
+	return data, nil
+}
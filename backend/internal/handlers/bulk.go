@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"nebula/backend/internal/api"
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/logger"
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/manager"
+)
+
+const (
+	maxBulkTextSize = 1 << 20
+	maxBulkItems    = 200
+
+	bulkModeAnalyze = "analyze"
+	bulkModeEnqueue = "enqueue"
+)
+
+type bulkRequest struct {
+	Text       string `json:"text"`
+	Mode       string `json:"mode"`
+	OutputDir  string `json:"output_dir"`
+	Sequential bool   `json:"sequential"`
+	Preset     string `json:"preset"`
+	// DownloadPreset aplica um preset de download aos itens enfileirados
+	DownloadPreset string `json:"download_preset"`
+	Private        bool   `json:"private"`
+
+	settings *downloadSettings
+}
+
+type bulkItem struct {
+	Input      string `json:"input"`
+	InfoHash   string `json:"info_hash,omitempty"`
+	MagnetLink string `json:"magnet_link,omitempty"`
+	// Status: pending (análise em JobID), queued, duplicate ou failed
+	Status     string `json:"status"`
+	JobID      string `json:"job_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	FileCount  int    `json:"file_count,omitempty"`
+	TotalSize  int64  `json:"total_size,omitempty"`
+	DownloadID string `json:"download_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HandleBulk extrai magnets e info hashes de um texto (ou arquivo .txt) e
+// cria um job de análise para cada um ou os coloca direto na fila
+// selecionando todos os arquivos
+func (h *DownloadHandler) HandleBulk(w http.ResponseWriter, r *http.Request) {
+	req, err := parseBulkRequest(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = bulkModeAnalyze
+	}
+	if req.Mode != bulkModeAnalyze && req.Mode != bulkModeEnqueue {
+		api.RespondWithError(w, http.StatusBadRequest, "mode must be analyze or enqueue")
+		return
+	}
+
+	if req.Mode == bulkModeEnqueue {
+		overrides := downloadOverrides{
+			DownloadPreset: req.DownloadPreset,
+			OutputDir:      req.OutputDir,
+			Preset:         req.Preset,
+		}
+		if req.Sequential {
+			overrides.Sequential = &req.Sequential
+		}
+		if req.Private {
+			overrides.Private = &req.Private
+		}
+		if req.settings, err = h.resolveSettings(overrides); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	found, invalid := magnet.Extract(req.Text)
+	if len(found) == 0 && len(invalid) == 0 {
+		api.RespondWithError(w, http.StatusBadRequest, "no magnet links or info hashes found")
+		return
+	}
+	if len(found) > maxBulkItems {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("too many items: %d (max %d)", len(found), maxBulkItems))
+		return
+	}
+
+	items := make([]bulkItem, len(found))
+	for i, f := range found {
+		items[i] = bulkItem{
+			Input:      f.Input,
+			InfoHash:   f.Magnet.InfoHash(),
+			MagnetLink: f.Magnet.String(),
+			Name:       f.Magnet.DisplayName,
+		}
+	}
+
+	for i := range items {
+		if req.Mode == bulkModeAnalyze {
+			h.bulkAnalyze(&items[i])
+		} else {
+			h.bulkEnqueue(&items[i], req)
+		}
+	}
+
+	for _, input := range invalid {
+		items = append(items, bulkItem{Input: input, Status: "failed", Error: "invalid magnet link"})
+	}
+
+	succeeded := 0
+	for _, item := range items {
+		if item.Status != "failed" {
+			succeeded++
+		}
+	}
+	logger.Info("bulk %s: %d items, %d succeeded", req.Mode, len(items), succeeded)
+
+	status := http.StatusOK
+	if req.Mode == bulkModeAnalyze {
+		status = http.StatusAccepted
+	}
+	api.RespondWithJSON(w, status, map[string]interface{}{
+		"mode":      req.Mode,
+		"total":     len(items),
+		"succeeded": succeeded,
+		"failed":    len(items) - succeeded,
+		"items":     items,
+	})
+}
+
+// bulkAnalyze envia o item para AnalysisJobs; o resultado sai em
+// /api/jobs/{id} e nos eventos SSE do job.
+func (h *DownloadHandler) bulkAnalyze(item *bulkItem) {
+	job, err := h.deps.AnalysisJobs.Submit(item.MagnetLink, manager.AnalysisOptions{})
+	if err != nil {
+		item.Status = "failed"
+		item.Error = err.Error()
+		return
+	}
+	item.Status = job.Status
+	item.JobID = job.ID
+}
+
+func (h *DownloadHandler) bulkEnqueue(item *bulkItem, req *bulkRequest) {
+	if existingID, active := h.deps.DownloadManager.FindActive(item.InfoHash); active {
+		item.Status = "duplicate"
+		item.DownloadID = existingID
+		return
+	}
+
+	settings := req.settings
+	name := item.Name
+	if name == "" {
+		name = "Processing..."
+	}
+	record := &downloader.DownloadRecord{
+		MagnetLink:      item.MagnetLink,
+		OutputDir:       settings.OutputDir,
+		Status:          "downloading",
+		TorrentName:     name,
+		SelectionPolicy: manager.SelectionAll,
+		SelectionRules:  settings.Rules,
+		Sequential:      settings.Sequential,
+		Preset:          settings.Preset,
+		Tags:            settings.Tags,
+		OnComplete:      settings.OnComplete,
+		ExtractArchives: settings.ExtractArchives,
+		Private:         settings.Private,
+		CreatedAt:       time.Now(),
+	}
+	if !settings.Transfer.IsZero() {
+		transfer := settings.Transfer
+		record.Transfer = &transfer
+	}
+
+	opts := manager.DownloadOptions{
+		SelectionPolicy: manager.SelectionAll,
+		Rules:           settings.Rules,
+		Transfer:        settings.Transfer,
+		OnComplete:      settings.OnComplete,
+		ExtractArchives: settings.ExtractArchives,
+		Private:         settings.Private,
+		Record:          record,
+	}
+	reporter := h.reporterFactory.NewReporter()
+	id, err := h.deps.DownloadManager.StartDownload(context.Background(), item.MagnetLink, settings.OutputDir, nil, settings.Sequential, reporter, opts)
+	var dup *manager.DuplicateError
+	if errors.As(err, &dup) {
+		item.Status = "duplicate"
+		item.DownloadID = dup.ExistingID
+		return
+	}
+	if err != nil {
+		item.Status = "failed"
+		item.Error = err.Error()
+		return
+	}
+
+	item.Status = "queued"
+	item.DownloadID = id
+}
+
+// parseBulkRequest aceita JSON, text/plain ou multipart com o campo "file".
+func parseBulkRequest(r *http.Request) (*bulkRequest, error) {
+	req := &bulkRequest{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxBulkTextSize); err != nil {
+			return nil, fmt.Errorf("failed to parse multipart form: %v", err)
+		}
+		req.Text = r.FormValue("text")
+		req.Mode = r.FormValue("mode")
+		req.OutputDir = r.FormValue("output_dir")
+		req.Sequential = r.FormValue("sequential") == "true"
+		req.Preset = r.FormValue("preset")
+		req.DownloadPreset = r.FormValue("download_preset")
+		req.Private = r.FormValue("private") == "true"
+
+		if file, _, err := r.FormFile("file"); err == nil {
+			defer file.Close()
+			data, err := readLimited(file)
+			if err != nil {
+				return nil, err
+			}
+			req.Text += "\n" + string(data)
+		}
+	case "text/plain":
+		data, err := readLimited(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Text = string(data)
+		req.Mode = r.URL.Query().Get("mode")
+		req.OutputDir = r.URL.Query().Get("output_dir")
+		req.Preset = r.URL.Query().Get("preset")
+		req.DownloadPreset = r.URL.Query().Get("download_preset")
+		req.Private = r.URL.Query().Get("private") == "true"
+	default:
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBulkTextSize+1024)).Decode(req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+	}
+
+	if strings.TrimSpace(req.Text) == "" {
+		return nil, errors.New("text or file is required")
+	}
+	return req, nil
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBulkTextSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %v", err)
+	}
+	if len(data) > maxBulkTextSize {
+		return nil, fmt.Errorf("input exceeds %d bytes", maxBulkTextSize)
+	}
+	return data, nil
+}
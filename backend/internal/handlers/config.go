@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"nebula/backend/internal/api"
-	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/config"
 	"nebula/backend/internal/logger"
+	"nebula/backend/internal/postprocess"
+	"nebula/backend/internal/selection"
+
+	"github.com/go-chi/chi/v5"
 )
 
 // ConfigHandler gerencia operações de configuração
@@ -26,6 +31,57 @@ func (h *ConfigHandler) HandleGetConfig(w http.ResponseWriter, r *http.Request)
 	api.RespondWithJSON(w, http.StatusOK, cfg)
 }
 
+// configPatchResponse é a resposta de PATCH /api/config
+type configPatchResponse struct {
+	Changed         []string          `json:"changed"`
+	RestartRequired []string          `json:"restart_required"`
+	NotApplied      []string          `json:"not_applied"`
+	Config          *config.AppConfig `json:"config"`
+}
+
+// configErrorResponse lista todos os campos rejeitados
+type configErrorResponse struct {
+	api.ErrorResponse
+	Fields config.ValidationError `json:"fields"`
+}
+
+// HandlePatchConfig altera qualquer subconjunto dos campos da configuração.
+// Todos os campos são validados antes de gravar; os erros voltam juntos
+func (h *ConfigHandler) HandlePatchConfig(w http.ResponseWriter, r *http.Request) {
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	changed, err := h.deps.ConfigManager.Patch(patch)
+	if err != nil {
+		var verr config.ValidationError
+		if errors.As(err, &verr) {
+			api.RespondWithJSON(w, http.StatusBadRequest, configErrorResponse{
+				ErrorResponse: api.ErrorResponse{Error: http.StatusText(http.StatusBadRequest), Message: "invalid config"},
+				Fields:        verr,
+			})
+			return
+		}
+		logger.Error("failed to save config: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to save config")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, configPatchResponse{
+		Changed:         changed,
+		RestartRequired: config.RestartRequired(changed),
+		NotApplied:      config.NotApplied(changed),
+		Config:          h.deps.ConfigManager.Get(),
+	})
+}
+
+// HandleGetConfigSchema descreve os campos aceitos por PATCH /api/config
+func (h *ConfigHandler) HandleGetConfigSchema(w http.ResponseWriter, r *http.Request) {
+	api.RespondWithJSON(w, http.StatusOK, config.Schema())
+}
+
 // HandleSetMaxDownloadSpeed define a velocidade máxima de download
 func (h *ConfigHandler) HandleSetMaxDownloadSpeed(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -49,11 +105,6 @@ func (h *ConfigHandler) HandleSetMaxDownloadSpeed(w http.ResponseWriter, r *http
 		return
 	}
 
-	h.deps.TorrentService.UpdateLimits(&downloader.DownloadConfig{
-		MaxDownloadSpeed: h.deps.ConfigManager.GetMaxDownloadSpeed(),
-		MaxUploadSpeed:   h.deps.ConfigManager.GetMaxUploadSpeed(),
-	})
-
 	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
@@ -80,14 +131,159 @@ func (h *ConfigHandler) HandleSetMaxUploadSpeed(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	h.deps.TorrentService.UpdateLimits(&downloader.DownloadConfig{
-		MaxDownloadSpeed: h.deps.ConfigManager.GetMaxDownloadSpeed(),
-		MaxUploadSpeed:   h.deps.ConfigManager.GetMaxUploadSpeed(),
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// HandleSetOnCompleteActions define as ações globais executadas após cada download
+func (h *ConfigHandler) HandleSetOnCompleteActions(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OnComplete []postprocess.Action `json:"on_complete"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if err := postprocess.ValidateActions(req.OnComplete); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.deps.ConfigManager.SetOnComplete(req.OnComplete); err != nil {
+		logger.Error("failed to set on-complete actions: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to update on-complete actions")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// historyRetention é o corpo de /api/config/history-retention
+type historyRetention struct {
+	MaxEntries int `json:"max_entries"`
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+// HandleGetHistoryRetention retorna os limites do histórico
+func (h *ConfigHandler) HandleGetHistoryRetention(w http.ResponseWriter, r *http.Request) {
+	cfg := h.deps.ConfigManager.Get()
+	api.RespondWithJSON(w, http.StatusOK, historyRetention{
+		MaxEntries: cfg.HistoryMaxEntries,
+		MaxAgeDays: cfg.HistoryMaxAgeDays,
 	})
+}
+
+// HandleSetHistoryRetention define os limites do histórico e descarta na hora
+// as entradas que passaram deles
+func (h *ConfigHandler) HandleSetHistoryRetention(w http.ResponseWriter, r *http.Request) {
+	var req historyRetention
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if req.MaxEntries < 0 || req.MaxAgeDays < 0 {
+		api.RespondWithError(w, http.StatusBadRequest, "history retention cannot be negative")
+		return
+	}
+
+	if err := h.deps.ConfigManager.SetHistoryRetention(req.MaxEntries, req.MaxAgeDays); err != nil {
+		logger.Error("failed to set history retention: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to update history retention")
+		return
+	}
+
+	if err := h.deps.Persistence.SetHistoryRetention(h.deps.ConfigManager.HistoryRetention()); err != nil {
+		logger.Error("failed to apply history retention: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to apply history retention")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// HandleSetDisableHistory liga ou desliga o modo privado global: com ele
+// nenhum download é gravado no histórico
+func (h *ConfigHandler) HandleSetDisableHistory(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DisableHistory bool `json:"disable_history"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if err := h.deps.ConfigManager.Set("disable_history", req.DisableHistory); err != nil {
+		logger.Error("failed to set disable_history: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to update history setting")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// HandleListSelectionPresets lista os presets de seleção de arquivos
+func (h *ConfigHandler) HandleListSelectionPresets(w http.ResponseWriter, r *http.Request) {
+	presets := h.deps.ConfigManager.Get().SelectionPresets
+	if presets == nil {
+		presets = map[string]selection.Rules{}
+	}
+	api.RespondWithJSON(w, http.StatusOK, presets)
+}
+
+// HandleSetSelectionPreset cria ou substitui um preset de seleção
+func (h *ConfigHandler) HandleSetSelectionPreset(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var rules selection.Rules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if err := rules.Validate(); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.deps.ConfigManager.SetSelectionPreset(name, rules); err != nil {
+		logger.Error("failed to save selection preset: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to save selection preset")
+		return
+	}
 
 	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
+// HandleDeleteSelectionPreset remove um preset de seleção
+func (h *ConfigHandler) HandleDeleteSelectionPreset(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if _, ok := h.deps.ConfigManager.SelectionPreset(name); !ok {
+		api.RespondWithError(w, http.StatusNotFound, "selection preset not found")
+		return
+	}
+
+	if err := h.deps.ConfigManager.DeleteSelectionPreset(name); err != nil {
+		var inUse *config.PresetInUseError
+		if errors.As(err, &inUse) {
+			api.RespondWithJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":   http.StatusText(http.StatusConflict),
+				"message": "selection preset is used by download presets",
+				"used_by": inUse.UsedBy,
+			})
+			return
+		}
+		logger.Error("failed to delete selection preset: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to delete selection preset")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
 // HandleGetFileTypes retorna os tipos de arquivo suportados
 func (h *ConfigHandler) HandleGetFileTypes(w http.ResponseWriter, r *http.Request) {
 	types := map[string]map[string]string{
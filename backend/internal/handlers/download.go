@@ -2,17 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"nebula/backend/internal/api"
 	"nebula/backend/internal/downloader"
 	"nebula/backend/internal/logger"
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/manager"
+	"nebula/backend/internal/selection"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -35,9 +40,13 @@ func NewDownloadHandler(deps *Dependencies, factory ProgressReporterFactory) *Do
 func (h *DownloadHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		MagnetLink      string `json:"magnet_link"`
-		OutputDir       string `json:"output_dir"`
 		SelectedIndices []int  `json:"selected_indices"`
-		Sequential      bool   `json:"sequential"`
+
+		// OnDuplicate: "merge" (padrão) junta a seleção ao download já ativo
+		// do mesmo torrent; "conflict" responde 409.
+		OnDuplicate string `json:"on_duplicate"`
+
+		downloadOverrides
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -51,23 +60,102 @@ func (h *DownloadHandler) HandleDownload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if req.OutputDir == "" {
-		cfg := h.deps.ConfigManager.Get()
-		req.OutputDir = cfg.DefaultDownloadDir
+	magnetLink, err := magnet.Normalize(req.MagnetLink)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid magnet_link: %v", err))
+		return
+	}
+
+	settings, err := h.resolveSettings(req.downloadOverrides)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.startDownload(w, r, magnetLink, req.SelectedIndices, settings, req.OnDuplicate)
+}
+
+// HandleDownloadFavorite baixa um favorito usando o download salvo nele. O
+// corpo é opcional e sobrepõe os campos salvos como em HandleDownload.
+func (h *DownloadHandler) HandleDownloadFavorite(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req struct {
+		SelectedIndices []int  `json:"selected_indices"`
+		OnDuplicate     string `json:"on_duplicate"`
+
+		downloadOverrides
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+
+	fav, err := h.deps.Persistence.GetFavorite(id)
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, "Failed to get favorites")
+		return
+	}
+	if fav == nil {
+		api.RespondWithError(w, http.StatusNotFound, "Favorite not found")
+		return
+	}
+
+	magnetLink, err := magnet.Normalize(fav.MagnetLink)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("favorite has an invalid magnet link: %v", err))
+		return
+	}
+
+	// O favorito fica entre o preset e o pedido: seus campos sobrepõem o
+	// preset e são sobrepostos pelo que vier no corpo
+	overrides := req.downloadOverrides
+	indices := req.SelectedIndices
+	if saved := fav.Download; saved != nil {
+		if overrides.DownloadPreset == "" {
+			overrides.DownloadPreset = saved.DownloadPreset
+		}
+		if overrides.OutputDir == "" {
+			overrides.OutputDir = saved.OutputDir
+		}
+		if overrides.Preset == "" && overrides.Rules == nil {
+			overrides.Preset, overrides.Rules = saved.SelectionPreset, saved.Rules
+		}
+		if len(indices) == 0 {
+			indices = saved.SelectedIndices
+		}
 	}
 
-	if err := api.ValidateOutputDir(req.OutputDir); err != nil {
+	settings, err := h.resolveSettings(overrides)
+	if err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if len(req.SelectedIndices) == 0 {
+	if len(indices) == 0 && settings.Rules == nil {
+		api.RespondWithError(w, http.StatusBadRequest, "favorite has no saved selection; send selected_indices, preset or rules")
+		return
+	}
+
+	h.startDownload(w, r, magnetLink, indices, settings, req.OnDuplicate)
+}
+
+// startDownload valida a seleção e inicia o download com as opções
+// resolvidas, respondendo com o id ou tratando o torrent já ativo.
+func (h *DownloadHandler) startDownload(w http.ResponseWriter, r *http.Request, magnetLink string, indices []int, settings *downloadSettings, onDuplicate string) {
+	if len(indices) == 0 && settings.Rules == nil {
 		api.RespondWithError(w, http.StatusBadRequest, "selected_indices cannot be empty")
 		return
 	}
 
 	seen := make(map[int]bool)
-	for _, idx := range req.SelectedIndices {
+	for _, idx := range indices {
 		if idx < 0 {
 			api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid file index: %d (must be non-negative)", idx))
 			return
@@ -79,62 +167,152 @@ func (h *DownloadHandler) HandleDownload(w http.ResponseWriter, r *http.Request)
 		seen[idx] = true
 	}
 
+	if onDuplicate != "" && onDuplicate != "merge" && onDuplicate != "conflict" {
+		api.RespondWithError(w, http.StatusBadRequest, "on_duplicate must be merge or conflict")
+		return
+	}
+
+	infoHash, _ := magnet.InfoHash(magnetLink)
+	if existingID, active := h.deps.DownloadManager.FindActive(infoHash); active {
+		h.respondDuplicate(w, existingID, h.duplicateIndices(infoHash, indices, settings.Rules), onDuplicate)
+		return
+	}
+
 	record := &downloader.DownloadRecord{
-		ID:              "",
-		MagnetLink:      req.MagnetLink,
-		OutputDir:       req.OutputDir,
-		SelectedIndices: req.SelectedIndices,
-		Status:          "pending",
+		MagnetLink:      magnetLink,
+		OutputDir:       settings.OutputDir,
+		SelectedIndices: indices,
+		Status:          "downloading",
+		TorrentName:     "Processing...",
 		Progress:        0,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
+		OnComplete:      settings.OnComplete,
+		ExtractArchives: settings.ExtractArchives,
+		SelectionRules:  settings.Rules,
+		Sequential:      settings.Sequential,
+		Preset:          settings.Preset,
+		Tags:            settings.Tags,
+		Private:         settings.Private,
+	}
+	if !settings.Transfer.IsZero() {
+		transfer := settings.Transfer
+		record.Transfer = &transfer
+	}
+
+	opts := manager.DownloadOptions{
+		OnComplete:      settings.OnComplete,
+		ExtractArchives: settings.ExtractArchives,
+		Rules:           settings.Rules,
+		Transfer:        settings.Transfer,
+		Private:         settings.Private,
+		Record:          record,
 	}
 
 	reporter := h.reporterFactory.NewReporter()
-	id, err := h.deps.DownloadManager.StartDownload(r.Context(), req.MagnetLink, req.OutputDir, req.SelectedIndices, req.Sequential, reporter)
+	id, err := h.deps.DownloadManager.StartDownload(r.Context(), magnetLink, settings.OutputDir, indices, settings.Sequential, reporter, opts)
+	var dup *manager.DuplicateError
+	if errors.As(err, &dup) {
+		h.respondDuplicate(w, dup.ExistingID, h.duplicateIndices(infoHash, indices, settings.Rules), onDuplicate)
+		return
+	}
 	if err != nil {
 		logger.Error("failed to start download: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to start download")
 		return
 	}
 
-	record.ID = id
-	record.Status = "downloading"
-	record.TorrentName = "Processing..."
-	if err := h.deps.Persistence.SaveDownload(record); err != nil {
-		logger.Warn("failed to save download record: %v", err)
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+// selectionRules resolve o preset nomeado ou as regras enviadas no pedido.
+func (h *DownloadHandler) selectionRules(preset string, rules *selection.Rules) (*selection.Rules, error) {
+	if preset != "" && rules != nil {
+		return nil, errors.New("use either preset or rules, not both")
+	}
+	if preset != "" {
+		saved, ok := h.deps.ConfigManager.SelectionPreset(preset)
+		if !ok {
+			return nil, fmt.Errorf("unknown selection preset: %s", preset)
+		}
+		return &saved, nil
 	}
+	if rules != nil {
+		if err := rules.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rules: %w", err)
+		}
+	}
+	return rules, nil
+}
 
-	api.RespondWithJSON(w, http.StatusOK, map[string]string{"id": id})
+// duplicateIndices aplica as regras do pedido à seleção que será juntada ao
+// download ativo, usando os metadados que ele já mantém em cache.
+func (h *DownloadHandler) duplicateIndices(infoHash string, indices []int, rules *selection.Rules) []int {
+	if rules == nil {
+		return indices
+	}
+	details := h.deps.TorrentService.CachedDetails(infoHash)
+	if details == nil {
+		return indices
+	}
+	return downloader.ApplyRules(details.Files, indices, rules)
 }
 
-// HandleListDownloads lista todos os downloads
+// respondDuplicate trata um pedido de download para um torrent já ativo.
+func (h *DownloadHandler) respondDuplicate(w http.ResponseWriter, existingID string, indices []int, onDuplicate string) {
+	if onDuplicate == "conflict" {
+		api.RespondWithJSON(w, http.StatusConflict, map[string]string{
+			"error":       http.StatusText(http.StatusConflict),
+			"message":     "torrent is already being downloaded",
+			"existing_id": existingID,
+		})
+		return
+	}
+
+	if err := h.deps.DownloadManager.MergeSelection(existingID, indices); err != nil {
+		logger.Warn("failed to merge selection into %s: %v", existingID, err)
+		api.RespondWithJSON(w, http.StatusConflict, map[string]string{
+			"error":       http.StatusText(http.StatusConflict),
+			"message":     fmt.Sprintf("could not merge selection: %v", err),
+			"existing_id": existingID,
+		})
+		return
+	}
+
+	logger.Info("merged %d files into active download %s", len(indices), existingID)
+	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"id": existingID, "merged": true})
+}
+
+// HandleListDownloads lista os downloads, filtrados por status (vários
+// separados por vírgula) e info_hash
 func (h *DownloadHandler) HandleListDownloads(w http.ResponseWriter, r *http.Request) {
-	status := r.URL.Query().Get("status")
+	query := r.URL.Query()
+	var filter downloader.DownloadFilter
+	for _, status := range strings.Split(query.Get("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			filter.Status = append(filter.Status, status)
+		}
+	}
+	if infoHash := query.Get("info_hash"); infoHash != "" {
+		ih, err := magnet.InfoHash(infoHash)
+		if err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, "invalid info_hash")
+			return
+		}
+		filter.InfoHash = ih
+	}
 
-	allDownloads, err := h.deps.Persistence.GetAllDownloads()
+	downloads, err := h.deps.Persistence.QueryDownloads(filter)
 	if err != nil {
 		logger.Error("failed to get downloads: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to retrieve downloads")
 		return
 	}
-
-	var filtered []*downloader.DownloadRecord
-	if status != "" {
-		for _, record := range allDownloads {
-			if record.Status == status {
-				filtered = append(filtered, record)
-			}
-		}
-	} else {
-		filtered = allDownloads
+	if downloads == nil {
+		downloads = []*downloader.DownloadRecord{}
 	}
 
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].UpdatedAt.After(filtered[j].UpdatedAt)
-	})
-
-	api.RespondWithJSON(w, http.StatusOK, filtered)
+	api.RespondWithJSON(w, http.StatusOK, downloads)
 }
 
 // HandleGetDownloadStatus retorna o status de um download
@@ -156,6 +334,18 @@ func (h *DownloadHandler) HandleGetDownloadStatus(w http.ResponseWriter, r *http
 		return
 	}
 
+	// A árvore depende dos metadados em cache (torrents analisados ou
+	// baixados desde que o backend iniciou)
+	if want, _ := strconv.ParseBool(r.URL.Query().Get("tree")); want {
+		if details := h.deps.TorrentService.CachedDetails(record.InfoHash); details != nil {
+			api.RespondWithJSON(w, http.StatusOK, struct {
+				*downloader.DownloadRecord
+				Tree *downloader.FileTreeNode `json:"tree"`
+			}{record, downloader.BuildFileTree(details.Files, record.SelectedIndices)})
+			return
+		}
+	}
+
 	api.RespondWithJSON(w, http.StatusOK, record)
 }
 
@@ -191,7 +381,7 @@ func (h *DownloadHandler) HandleCancelDownload(w http.ResponseWriter, r *http.Re
 
 	_ = h.deps.DownloadManager.CancelDownload(id)
 
-	if err := h.deps.Persistence.DeleteDownload(id); err != nil {
+	if err := h.deps.DownloadManager.DeleteDownload(id); err != nil {
 		logger.Warn("failed to delete download record (may not exist): %v", err)
 	}
 
@@ -245,7 +435,7 @@ func (h *DownloadHandler) HandleDeleteDownloadFiles(w http.ResponseWriter, r *ht
 		}
 	}
 
-	if err := h.deps.Persistence.DeleteDownload(id); err != nil {
+	if err := h.deps.DownloadManager.DeleteDownload(id); err != nil {
 		logger.Error("failed to delete download record: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to delete download record")
 		return
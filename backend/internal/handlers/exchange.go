@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nebula/backend/internal/api"
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/logger"
+)
+
+const maxImportSize = 10 << 20
+
+var exportContentTypes = map[string]string{
+	downloader.FormatJSON:   "application/json",
+	downloader.FormatCSV:    "text/csv; charset=utf-8",
+	downloader.FormatMagnet: "text/plain; charset=utf-8",
+}
+
+var exportExtensions = map[string]string{
+	downloader.FormatJSON:   "json",
+	downloader.FormatCSV:    "csv",
+	downloader.FormatMagnet: "txt",
+}
+
+// importRequest é o conteúdo de um pedido de importação: o corpo (ou o campo
+// "file" de um multipart), o formato e se é apenas uma prévia.
+type importRequest struct {
+	data   []byte
+	format string
+	dryRun bool
+}
+
+// parseImportRequest lê o formato de ?format= ou, na falta dele, do
+// Content-Type do corpo ou da extensão do arquivo enviado.
+func parseImportRequest(r *http.Request) (*importRequest, error) {
+	req := &importRequest{format: r.URL.Query().Get("format")}
+	req.dryRun, _ = strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var body io.Reader = r.Body
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			return nil, fmt.Errorf("failed to parse multipart form: %v", err)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("file is required")
+		}
+		defer file.Close()
+		body = file
+		if req.format == "" {
+			req.format = formatFromName(header.Filename)
+		}
+		if v := r.FormValue("dry_run"); v != "" {
+			req.dryRun, _ = strconv.ParseBool(v)
+		}
+	} else if req.format == "" {
+		switch mediaType {
+		case "text/csv":
+			req.format = downloader.FormatCSV
+		case "text/plain":
+			req.format = downloader.FormatMagnet
+		default:
+			req.format = downloader.FormatJSON
+		}
+	}
+
+	if err := downloader.ValidateExchangeFormat(req.format); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxImportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %v", err)
+	}
+	if len(data) > maxImportSize {
+		return nil, fmt.Errorf("input exceeds %d bytes", maxImportSize)
+	}
+	req.data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	return req, nil
+}
+
+func formatFromName(name string) string {
+	switch {
+	case strings.HasSuffix(strings.ToLower(name), ".csv"):
+		return downloader.FormatCSV
+	case strings.HasSuffix(strings.ToLower(name), ".txt"):
+		return downloader.FormatMagnet
+	default:
+		return downloader.FormatJSON
+	}
+}
+
+// exportFormat lê ?format= (padrão json).
+func exportFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = downloader.FormatJSON
+	}
+	return format, downloader.ValidateExchangeFormat(format)
+}
+
+// writeExport responde com o arquivo exportado como anexo.
+func writeExport(w http.ResponseWriter, format, name string, encode func(io.Writer) error) {
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		logger.Error("failed to export %s: %v", name, err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to export "+name)
+		return
+	}
+
+	filename := fmt.Sprintf("nebula-%s-%s.%s", name, time.Now().Format("20060102"), exportExtensions[format])
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleExportFavorites exporta os favoritos em json, csv ou lista de magnets
+func (h *FavoritesHandler) HandleExportFavorites(w http.ResponseWriter, r *http.Request) {
+	format, err := exportFormat(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := h.deps.Persistence.GetFavorites()
+	if err != nil {
+		api.RespondWithError(w, http.StatusInternalServerError, "Failed to get favorites")
+		return
+	}
+
+	writeExport(w, format, "favorites", func(out io.Writer) error {
+		return downloader.EncodeFavorites(out, format, records)
+	})
+}
+
+// HandleImportFavorites importa favoritos juntando-os aos existentes pelo
+// info hash. Com ?dry_run=true apenas mostra o que seria feito
+func (h *FavoritesHandler) HandleImportFavorites(w http.ResponseWriter, r *http.Request) {
+	req, err := parseImportRequest(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, invalid, err := downloader.DecodeFavorites(req.data, req.format)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.deps.Persistence.ImportFavorites(records, req.dryRun)
+	if err != nil {
+		logger.Error("failed to import favorites: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to import favorites")
+		return
+	}
+	for _, item := range invalid {
+		result.Invalid++
+		result.Items = append(result.Items, item)
+	}
+
+	if !req.dryRun {
+		logger.Info("imported favorites: %d added, %d updated, %d conflicts, %d invalid", result.Added, result.Updated, result.Conflicts, result.Invalid)
+	}
+	api.RespondWithJSON(w, http.StatusOK, result)
+}
+
+// HandleExportHistory exporta o histórico em json, csv ou lista de magnets
+func (h *HistoryHandler) HandleExportHistory(w http.ResponseWriter, r *http.Request) {
+	format, err := exportFormat(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := h.deps.Persistence.GetHistory(0)
+	if err != nil {
+		logger.Error("failed to get history: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to retrieve history")
+		return
+	}
+
+	writeExport(w, format, "history", func(out io.Writer) error {
+		return downloader.EncodeHistory(out, format, records)
+	})
+}
+
+// HandleImportHistory importa entradas de histórico juntando-as pelo info
+// hash. Com ?dry_run=true apenas mostra o que seria feito
+func (h *HistoryHandler) HandleImportHistory(w http.ResponseWriter, r *http.Request) {
+	req, err := parseImportRequest(r)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, invalid, err := downloader.DecodeHistory(req.data, req.format)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.deps.Persistence.ImportHistory(records, req.dryRun)
+	if err != nil {
+		logger.Error("failed to import history: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to import history")
+		return
+	}
+	for _, item := range invalid {
+		result.Invalid++
+		result.Items = append(result.Items, item)
+	}
+
+	if !req.dryRun {
+		logger.Info("imported history: %d added, %d updated, %d conflicts, %d invalid", result.Added, result.Updated, result.Conflicts, result.Invalid)
+	}
+	api.RespondWithJSON(w, http.StatusOK, result)
+}
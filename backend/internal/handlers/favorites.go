@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"nebula/backend/internal/api"
+	"nebula/backend/internal/downloader"
 	"nebula/backend/internal/logger"
 
 	"github.com/go-chi/chi/v5"
@@ -23,9 +26,50 @@ func NewFavoritesHandler(deps *Dependencies) *FavoritesHandler {
 	return &FavoritesHandler{deps: deps}
 }
 
-// HandleGetFavorites retorna todos os favoritos
+// HandleGetFavorites lista os favoritos, com filtros opcionais por tag
+// (?tag=, repetível ou separado por vírgula) e texto (?q=) e ordenação
+// (?sort=added_at|updated_at|name&order=asc|desc)
 func (h *FavoritesHandler) HandleGetFavorites(w http.ResponseWriter, r *http.Request) {
-	records, err := h.deps.Persistence.GetFavorites()
+	query := r.URL.Query()
+
+	var tags []string
+	for _, v := range query["tag"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+
+	sortBy := query.Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = downloader.FavoriteSortAdded
+	case downloader.FavoriteSortAdded, downloader.FavoriteSortUpdated, downloader.FavoriteSortName:
+	default:
+		api.RespondWithError(w, http.StatusBadRequest, "sort must be added_at, updated_at or name")
+		return
+	}
+
+	// Datas do mais recente para o mais antigo; nomes em ordem alfabética
+	desc := sortBy != downloader.FavoriteSortName
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		api.RespondWithError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	records, err := h.deps.Persistence.QueryFavorites(downloader.FavoriteQuery{
+		Tags: tags,
+		Text: query.Get("q"),
+		Sort: sortBy,
+		Desc: desc,
+	})
 	if err != nil {
 		api.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -33,17 +77,92 @@ func (h *FavoritesHandler) HandleGetFavorites(w http.ResponseWriter, r *http.Req
 
 	result := make([]map[string]interface{}, len(records))
 	for i, fav := range records {
-		result[i] = map[string]interface{}{
-			"id":          fmt.Sprintf("%d", fav.ID),
-			"name":        fav.TorrentName,
-			"magnet_link": fav.MagnetLink,
-			"created_at":  fav.AddedAt.Format(time.RFC3339),
-		}
+		result[i] = favoriteResponse(fav)
 	}
 
 	api.RespondWithJSON(w, http.StatusOK, result)
 }
 
+// favoriteResponse mantém os campos que o frontend já usa (id em string,
+// name e created_at) junto com os demais dados do favorito.
+func favoriteResponse(fav *downloader.FavoriteRecord) map[string]interface{} {
+	tags := fav.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	result := map[string]interface{}{
+		"id":          fmt.Sprintf("%d", fav.ID),
+		"name":        fav.TorrentName,
+		"magnet_link": fav.MagnetLink,
+		"info_hash":   fav.InfoHash,
+		"tags":        tags,
+		"notes":       fav.Notes,
+		"created_at":  fav.AddedAt.Format(time.RFC3339),
+		"updated_at":  fav.UpdatedAt.Format(time.RFC3339),
+	}
+	if fav.Download != nil {
+		result["download"] = fav.Download
+	}
+	return result
+}
+
+// HandleGetFavoriteTags lista as tags usadas nos favoritos com a contagem
+func (h *FavoritesHandler) HandleGetFavoriteTags(w http.ResponseWriter, r *http.Request) {
+	api.RespondWithJSON(w, http.StatusOK, h.deps.Persistence.FavoriteTags())
+}
+
+// HandleUpdateFavorite altera nome, tags, notas ou download salvo de um
+// favorito; campos ausentes não mudam
+func (h *FavoritesHandler) HandleUpdateFavorite(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "Invalid ID format")
+		return
+	}
+
+	var req struct {
+		Name     *string                      `json:"name"`
+		Tags     *[]string                    `json:"tags"`
+		Notes    *string                      `json:"notes"`
+		Download *downloader.FavoriteDownload `json:"download"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		api.RespondWithError(w, http.StatusBadRequest, "name cannot be empty")
+		return
+	}
+
+	if req.Download != nil {
+		if err := h.validateFavoriteDownload(req.Download); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	fav, err := h.deps.Persistence.UpdateFavorite(id, downloader.FavoriteUpdate{
+		Name:     req.Name,
+		Tags:     req.Tags,
+		Notes:    req.Notes,
+		Download: req.Download,
+	})
+	if err != nil {
+		logger.Error("failed to update favorite: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to update favorite")
+		return
+	}
+	if fav == nil {
+		api.RespondWithError(w, http.StatusNotFound, "Favorite not found")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, favoriteResponse(fav))
+}
+
 // HandleAddFavorite adiciona um novo favorito
 func (h *FavoritesHandler) HandleAddFavorite(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -52,6 +171,9 @@ func (h *FavoritesHandler) HandleAddFavorite(w http.ResponseWriter, r *http.Requ
 		MagnetLink string   `json:"magnet_link"`
 		Tags       []string `json:"tags"`
 		Notes      string   `json:"notes"`
+
+		// Download opcional salvo com o favorito
+		Download *downloader.FavoriteDownload `json:"download"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -64,12 +186,19 @@ func (h *FavoritesHandler) HandleAddFavorite(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if req.Download != nil {
+		if err := h.validateFavoriteDownload(req.Download); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	name := req.Name
 	if name == "" {
 		name = "Download Favorito"
 	}
 
-	if err := h.deps.Persistence.AddFavorite(req.MagnetLink, name, req.Tags, req.Notes); err != nil {
+	if err := h.deps.Persistence.AddFavorite(req.MagnetLink, name, req.Tags, req.Notes, req.Download); err != nil {
 		logger.Error("failed to add favorite: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to add favorite")
 		return
@@ -78,6 +207,39 @@ func (h *FavoritesHandler) HandleAddFavorite(w http.ResponseWriter, r *http.Requ
 	api.RespondWithJSON(w, http.StatusCreated, map[string]string{"status": "created"})
 }
 
+// validateFavoriteDownload confere a seleção e os presets referenciados.
+func (h *FavoritesHandler) validateFavoriteDownload(d *downloader.FavoriteDownload) error {
+	for _, idx := range d.SelectedIndices {
+		if idx < 0 {
+			return fmt.Errorf("invalid file index: %d (must be non-negative)", idx)
+		}
+	}
+	if d.SelectionPreset != "" && d.Rules != nil {
+		return errors.New("use either selection_preset or rules, not both")
+	}
+	if d.SelectionPreset != "" {
+		if _, ok := h.deps.ConfigManager.SelectionPreset(d.SelectionPreset); !ok {
+			return fmt.Errorf("unknown selection preset: %s", d.SelectionPreset)
+		}
+	}
+	if d.Rules != nil {
+		if err := d.Rules.Validate(); err != nil {
+			return fmt.Errorf("invalid rules: %w", err)
+		}
+	}
+	if d.DownloadPreset != "" {
+		if _, ok := h.deps.ConfigManager.DownloadPreset(d.DownloadPreset); !ok {
+			return fmt.Errorf("unknown download preset: %s", d.DownloadPreset)
+		}
+	}
+	if d.OutputDir != "" {
+		if err := api.ValidateOutputDir(d.OutputDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // HandleRemoveFavorite remove um favorito
 func (h *FavoritesHandler) HandleRemoveFavorite(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
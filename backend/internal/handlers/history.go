@@ -3,13 +3,22 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"nebula/backend/internal/api"
 	"nebula/backend/internal/downloader"
 	"nebula/backend/internal/logger"
+
+	"github.com/go-chi/chi/v5"
 )
 
-const defaultHistoryLimit = 100
+const (
+	defaultHistoryLimit = 100
+	defaultSearchLimit  = 50
+	maxHistoryLimit     = 1000
+)
 
 // HistoryHandler gerencia operações de histórico
 type HistoryHandler struct {
@@ -21,12 +30,29 @@ func NewHistoryHandler(deps *Dependencies) *HistoryHandler {
 	return &HistoryHandler{deps: deps}
 }
 
-// HandleGetHistory retorna o histórico de downloads
+// HandleGetHistory retorna o histórico de downloads, com filtros por data
+// (?from=&to=), ordenação (?sort=accessed_at|name|size&order=asc|desc) e
+// paginação (?offset=&limit=)
 func (h *HistoryHandler) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
-	limit := defaultHistoryLimit
-	fmt.Sscanf(r.URL.Query().Get("limit"), "%d", &limit)
+	h.respondHistory(w, r, defaultHistoryLimit)
+}
 
-	records, err := h.deps.Persistence.GetHistory(limit)
+// HandleSearchHistory busca no histórico (?q=), aceitando os mesmos filtros e
+// a mesma paginação da listagem
+func (h *HistoryHandler) HandleSearchHistory(w http.ResponseWriter, r *http.Request) {
+	h.respondHistory(w, r, defaultSearchLimit)
+}
+
+// respondHistory responde com a página pedida. O total vai em X-Total-Count e,
+// se houver mais entradas, o header Link aponta para a próxima página.
+func (h *HistoryHandler) respondHistory(w http.ResponseWriter, r *http.Request, defaultLimit int) {
+	q, err := parseHistoryQuery(r.URL.Query(), defaultLimit)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, total, err := h.deps.Persistence.QueryHistory(q)
 	if err != nil {
 		logger.Error("failed to get history: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to retrieve history")
@@ -38,24 +64,147 @@ func (h *HistoryHandler) HandleGetHistory(w http.ResponseWriter, r *http.Request
 		dtos[i] = rec.ToDTO()
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if next := q.Offset + len(records); q.Limit > 0 && next < total {
+		params := r.URL.Query()
+		params.Set("offset", strconv.Itoa(next))
+		params.Set("limit", strconv.Itoa(q.Limit))
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, params.Encode()))
+	}
+
 	api.RespondWithJSON(w, http.StatusOK, dtos)
 }
 
-// HandleSearchHistory busca no histórico
-func (h *HistoryHandler) HandleSearchHistory(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	records, err := h.deps.Persistence.SearchHistory(query)
+func parseHistoryQuery(params url.Values, defaultLimit int) (downloader.HistoryQuery, error) {
+	q := downloader.HistoryQuery{
+		Text:  params.Get("q"),
+		Limit: defaultLimit,
+	}
+
+	var err error
+	if v := params.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxHistoryLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+	}
+
+	if q.From, err = parseHistoryDate(params.Get("from"), false); err != nil {
+		return q, fmt.Errorf("invalid from: %v", err)
+	}
+	if q.To, err = parseHistoryDate(params.Get("to"), true); err != nil {
+		return q, fmt.Errorf("invalid to: %v", err)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return q, fmt.Errorf("to must not be before from")
+	}
+
+	q.Sort = params.Get("sort")
+	switch q.Sort {
+	case "":
+		q.Sort = downloader.HistorySortAccessed
+	case downloader.HistorySortAccessed, downloader.HistorySortName, downloader.HistorySortSize:
+	default:
+		return q, fmt.Errorf("sort must be accessed_at, name or size")
+	}
+
+	// Datas e tamanhos do maior para o menor; nomes em ordem alfabética
+	q.Desc = q.Sort != downloader.HistorySortName
+	switch params.Get("order") {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	return q, nil
+}
+
+// parseHistoryDate aceita RFC3339 ou apenas a data (YYYY-MM-DD). Uma data
+// sem hora usada como limite final inclui o dia inteiro.
+func parseHistoryDate(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
 	if err != nil {
-		logger.Error("failed to search history: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to search history")
+		return time.Time{}, fmt.Errorf("expected RFC3339 or YYYY-MM-DD")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// HandleDeleteHistory remove uma entrada do histórico
+func (h *HistoryHandler) HandleDeleteHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, "invalid history id")
 		return
 	}
 
-	dtos := make([]*downloader.HistoryRecordDTO, len(records))
-	for i, rec := range records {
-		dtos[i] = rec.ToDTO()
+	found, err := h.deps.Persistence.DeleteHistory(id)
+	if err != nil {
+		logger.Error("failed to delete history entry: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to delete history entry")
+		return
+	}
+	if !found {
+		api.RespondWithError(w, http.StatusNotFound, "history entry not found")
+		return
 	}
 
-	api.RespondWithJSON(w, http.StatusOK, dtos)
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// HandleClearHistory remove as entradas acessadas antes de ?before= ou há mais
+// de ?older_than_days= dias. Apagar tudo exige ?all=true
+func (h *HistoryHandler) HandleClearHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var before time.Time
+	switch {
+	case query.Get("before") != "":
+		t, err := parseHistoryDate(query.Get("before"), false)
+		if err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid before: %v", err))
+			return
+		}
+		before = t
+	case query.Get("older_than_days") != "":
+		days, err := strconv.Atoi(query.Get("older_than_days"))
+		if err != nil || days < 0 {
+			api.RespondWithError(w, http.StatusBadRequest, "older_than_days must be a non-negative integer")
+			return
+		}
+		before = time.Now().AddDate(0, 0, -days)
+	default:
+		if all, _ := strconv.ParseBool(query.Get("all")); !all {
+			api.RespondWithError(w, http.StatusBadRequest, "before, older_than_days or all=true is required")
+			return
+		}
+	}
+
+	removed, err := h.deps.Persistence.ClearHistory(before)
+	if err != nil {
+		logger.Error("failed to clear history: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to clear history")
+		return
+	}
+
+	if removed > 0 {
+		logger.Info("cleared %d history entries", removed)
+	}
+	api.RespondWithJSON(w, http.StatusOK, map[string]int{"removed": removed})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nebula/backend/internal/api"
+	"nebula/backend/internal/logger"
+	"nebula/backend/internal/manager"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// JobsHandler gerencia jobs de análise em segundo plano
+type JobsHandler struct {
+	deps *Dependencies
+}
+
+// NewJobsHandler cria um novo handler de jobs
+func NewJobsHandler(deps *Dependencies) *JobsHandler {
+	return &JobsHandler{deps: deps}
+}
+
+// HandleCreateJob inicia a análise de um magnet e retorna o id do job
+func (h *JobsHandler) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MagnetLink    string `json:"magnet_link"`
+		Health        bool   `json:"health"`
+		HealthTimeout int    `json:"health_timeout"` // segundos
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	job, err := h.deps.AnalysisJobs.Submit(req.MagnetLink, manager.AnalysisOptions{
+		Health:        req.Health,
+		HealthTimeout: time.Duration(req.HealthTimeout) * time.Second,
+	})
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.Info("analysis job %s started for %s", job.ID, job.InfoHash)
+	api.RespondWithJSON(w, http.StatusAccepted, job)
+}
+
+// HandleListJobs lista os jobs de análise
+func (h *JobsHandler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	api.RespondWithJSON(w, http.StatusOK, h.deps.AnalysisJobs.List())
+}
+
+// HandleGetJob retorna o estado e, quando concluído, o resultado de um job
+func (h *JobsHandler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.deps.AnalysisJobs.Get(chi.URLParam(r, "id"))
+	if errors.Is(err, manager.ErrJobNotFound) {
+		api.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, job)
+}
+
+// HandleCancelJob cancela um job em andamento e descarta o torrent
+func (h *JobsHandler) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	if err := h.deps.AnalysisJobs.Cancel(chi.URLParam(r, "id")); err != nil {
+		api.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "canceled"})
+}
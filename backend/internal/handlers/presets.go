@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nebula/backend/internal/api"
+	"nebula/backend/internal/config"
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/logger"
+	"nebula/backend/internal/postprocess"
+	"nebula/backend/internal/selection"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// downloadOverrides são os campos de um pedido de download que sobrepõem o
+// preset escolhido em DownloadPreset. Ponteiros distinguem "não enviado" de
+// zero.
+type downloadOverrides struct {
+	DownloadPreset string `json:"download_preset"`
+	OutputDir      string `json:"output_dir"`
+	Sequential     *bool  `json:"sequential"`
+
+	// Preset (nome salvo na configuração) ou Rules escolhem os arquivos
+	// automaticamente, sozinhos ou filtrando selected_indices.
+	Preset string           `json:"preset"`
+	Rules  *selection.Rules `json:"rules"`
+
+	MaxDownloadSpeed *int64   `json:"max_download_speed"`
+	MaxUploadSpeed   *int64   `json:"max_upload_speed"`
+	SeedRatio        *float64 `json:"seed_ratio"`
+	SeedTime         *int     `json:"seed_time"`
+
+	Tags            []string             `json:"tags"`
+	OnComplete      []postprocess.Action `json:"on_complete"`
+	ExtractArchives *bool                `json:"extract_archives"`
+
+	// Private não grava histórico nem guarda o registro depois de concluído
+	Private *bool `json:"private"`
+}
+
+// downloadSettings são as opções efetivas depois de aplicar preset e pedido.
+type downloadSettings struct {
+	Preset          string
+	OutputDir       string
+	Sequential      bool
+	Rules           *selection.Rules
+	Transfer        downloader.TransferOptions
+	Tags            []string
+	OnComplete      []postprocess.Action
+	ExtractArchives *bool
+	Private         bool
+}
+
+// resolveSettings parte do preset de download (se houver) e aplica os campos
+// enviados no pedido.
+func (h *DownloadHandler) resolveSettings(o downloadOverrides) (*downloadSettings, error) {
+	settings := &downloadSettings{Preset: o.DownloadPreset}
+	var selectionPreset string
+
+	if o.DownloadPreset != "" {
+		preset, ok := h.deps.ConfigManager.DownloadPreset(o.DownloadPreset)
+		if !ok {
+			return nil, fmt.Errorf("unknown download preset: %s", o.DownloadPreset)
+		}
+		settings.OutputDir = preset.OutputDir
+		settings.Sequential = preset.Sequential
+		settings.Rules = preset.Rules
+		settings.Transfer = preset.TransferOptions
+		settings.Tags = preset.Tags
+		settings.OnComplete = preset.OnComplete
+		settings.ExtractArchives = preset.ExtractArchives
+		settings.Private = preset.Private
+		selectionPreset = preset.SelectionPreset
+	}
+
+	if o.OutputDir != "" {
+		settings.OutputDir = o.OutputDir
+	}
+	if settings.OutputDir == "" {
+		settings.OutputDir = h.deps.ConfigManager.Get().DefaultDownloadDir
+	}
+	if o.Sequential != nil {
+		settings.Sequential = *o.Sequential
+	}
+
+	if o.Preset != "" || o.Rules != nil {
+		selectionPreset, settings.Rules = o.Preset, o.Rules
+	}
+	rules, err := h.selectionRules(selectionPreset, settings.Rules)
+	if err != nil {
+		return nil, err
+	}
+	settings.Rules = rules
+
+	if o.MaxDownloadSpeed != nil {
+		settings.Transfer.MaxDownloadSpeed = *o.MaxDownloadSpeed
+	}
+	if o.MaxUploadSpeed != nil {
+		settings.Transfer.MaxUploadSpeed = *o.MaxUploadSpeed
+	}
+	if o.SeedRatio != nil {
+		settings.Transfer.SeedRatio = *o.SeedRatio
+	}
+	if o.SeedTime != nil {
+		settings.Transfer.SeedTime = *o.SeedTime
+	}
+	if o.Tags != nil {
+		settings.Tags = o.Tags
+	}
+	if o.OnComplete != nil {
+		settings.OnComplete = o.OnComplete
+	}
+	if o.ExtractArchives != nil {
+		settings.ExtractArchives = o.ExtractArchives
+	}
+	if o.Private != nil {
+		settings.Private = *o.Private
+	}
+	// Com o histórico desativado todo download é privado
+	if h.deps.ConfigManager.Get().DisableHistory {
+		settings.Private = true
+	}
+
+	if err := api.ValidateOutputDir(settings.OutputDir); err != nil {
+		return nil, err
+	}
+	if err := postprocess.ValidateActions(settings.OnComplete); err != nil {
+		return nil, fmt.Errorf("invalid on_complete: %v", err)
+	}
+	t := settings.Transfer
+	if t.MaxDownloadSpeed < 0 || t.MaxUploadSpeed < 0 || t.SeedRatio < 0 || t.SeedTime < 0 {
+		return nil, fmt.Errorf("speed limits and seeding goal cannot be negative")
+	}
+
+	return settings, nil
+}
+
+// HandleListDownloadPresets lista os presets de download
+func (h *ConfigHandler) HandleListDownloadPresets(w http.ResponseWriter, r *http.Request) {
+	presets := h.deps.ConfigManager.Get().DownloadPresets
+	if presets == nil {
+		presets = map[string]config.DownloadPreset{}
+	}
+	api.RespondWithJSON(w, http.StatusOK, presets)
+}
+
+// HandleGetDownloadPreset retorna um preset de download
+func (h *ConfigHandler) HandleGetDownloadPreset(w http.ResponseWriter, r *http.Request) {
+	preset, ok := h.deps.ConfigManager.DownloadPreset(chi.URLParam(r, "name"))
+	if !ok {
+		api.RespondWithError(w, http.StatusNotFound, "download preset not found")
+		return
+	}
+	api.RespondWithJSON(w, http.StatusOK, preset)
+}
+
+// HandleSetDownloadPreset cria ou substitui um preset de download
+func (h *ConfigHandler) HandleSetDownloadPreset(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var preset config.DownloadPreset
+	if err := json.NewDecoder(r.Body).Decode(&preset); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if err := preset.Validate(); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if preset.OutputDir != "" {
+		if err := api.ValidateOutputDir(preset.OutputDir); err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if preset.SelectionPreset != "" {
+		if _, ok := h.deps.ConfigManager.SelectionPreset(preset.SelectionPreset); !ok {
+			api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("unknown selection preset: %s", preset.SelectionPreset))
+			return
+		}
+	}
+
+	if err := h.deps.ConfigManager.SetDownloadPreset(name, preset); err != nil {
+		logger.Error("failed to save download preset: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to save download preset")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// HandleDeleteDownloadPreset remove um preset de download
+func (h *ConfigHandler) HandleDeleteDownloadPreset(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if _, ok := h.deps.ConfigManager.DownloadPreset(name); !ok {
+		api.RespondWithError(w, http.StatusNotFound, "download preset not found")
+		return
+	}
+
+	if err := h.deps.ConfigManager.DeleteDownloadPreset(name); err != nil {
+		logger.Error("failed to delete download preset: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to delete download preset")
+		return
+	}
+
+	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -3,11 +3,16 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"nebula/backend/internal/api"
 	"nebula/backend/internal/downloader"
 	"nebula/backend/internal/logger"
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/swarm"
 )
 
 const maxMultipartFormSize = 10 << 20
@@ -34,28 +39,56 @@ func (h *TorrentHandler) HandleAnalyzeMagnet(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := api.ValidateMagnetLink(req.MagnetLink); err != nil {
+	m, err := magnet.Parse(req.MagnetLink)
+	if err != nil {
 		logger.Warn("Invalid magnet link: %v", err)
 		api.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !m.HasV1() {
+		api.RespondWithError(w, http.StatusBadRequest, downloader.ErrV2Only.Error())
+		return
+	}
 
-	files, name, err := h.deps.TorrentService.GetTorrentInfo(req.MagnetLink)
+	details, err := h.deps.TorrentService.AnalyzeMagnetContext(r.Context(), m.String(), nil)
 	if err != nil {
 		logger.Error("Failed to get torrent info: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "Failed to analyze torrent")
 		return
 	}
 
-	infoHash := extractInfoHash(req.MagnetLink)
+	attachTree(r, details)
+	h.attachHealth(r, details)
+
+	api.RespondWithJSON(w, http.StatusOK, details)
+}
 
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"files":       files,
-		"name":        name,
-		"info_hash":   infoHash,
-		"magnet_link": req.MagnetLink,
-		"total_size":  calculateTotalSize(files),
-	})
+// attachTree inclui a árvore de arquivos quando a requisição pede ?tree=true.
+func attachTree(r *http.Request, details *downloader.TorrentDetails) {
+	if want, _ := strconv.ParseBool(r.URL.Query().Get("tree")); want {
+		details.Tree = downloader.BuildFileTree(details.Files, nil)
+	}
+}
+
+// attachHealth consulta trackers e DHT quando a requisição pede ?health=true.
+// O tempo é limitado por health_timeout (segundos, máximo swarm.MaxTimeout).
+func (h *TorrentHandler) attachHealth(r *http.Request, details *downloader.TorrentDetails) {
+	if want, _ := strconv.ParseBool(r.URL.Query().Get("health")); !want {
+		return
+	}
+
+	timeout := swarm.DefaultTimeout
+	if secs, err := strconv.Atoi(r.URL.Query().Get("health_timeout")); err == nil && secs > 0 {
+		timeout = time.Duration(secs) * time.Second
+	}
+
+	checker := &swarm.Checker{DHT: h.deps.TorrentService}
+	health, err := checker.Check(r.Context(), details.InfoHash, details.Trackers(), timeout)
+	if err != nil {
+		logger.Warn("swarm health check failed for %s: %v", details.InfoHash, err)
+		return
+	}
+	details.Health = health
 }
 
 // HandleAnalyzeTorrentFile analisa um arquivo torrent
@@ -72,25 +105,23 @@ func (h *TorrentHandler) HandleAnalyzeTorrentFile(w http.ResponseWriter, r *http
 	}
 	defer file.Close()
 
-	data := make([]byte, maxMultipartFormSize)
-	n, err := file.Read(data)
-	if err != nil && err.Error() != "EOF" {
+	data, err := io.ReadAll(io.LimitReader(file, maxMultipartFormSize))
+	if err != nil {
 		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to read file: %v", err))
 		return
 	}
 
-	files, name, magnetLink, err := h.deps.TorrentService.AddTorrentFromBytes(data[:n])
+	details, err := h.deps.TorrentService.AnalyzeTorrentBytes(data)
 	if err != nil {
 		logger.Error("failed to analyze torrent file: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to analyze torrent file")
 		return
 	}
 
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"files":       files,
-		"name":        name,
-		"magnet_link": magnetLink,
-	})
+	attachTree(r, details)
+	h.attachHealth(r, details)
+
+	api.RespondWithJSON(w, http.StatusOK, details)
 }
 
 // HandleAnalyzeTorrentBytes analisa bytes de torrent
@@ -104,18 +135,59 @@ func (h *TorrentHandler) HandleAnalyzeTorrentBytes(w http.ResponseWriter, r *htt
 		return
 	}
 
-	files, name, magnetLink, err := h.deps.TorrentService.AddTorrentFromBytes(req.Data)
+	details, err := h.deps.TorrentService.AnalyzeTorrentBytes(req.Data)
 	if err != nil {
 		logger.Error("failed to analyze torrent bytes: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to analyze torrent data")
 		return
 	}
 
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"files":       files,
-		"name":        name,
-		"magnet_link": magnetLink,
-	})
+	attachTree(r, details)
+	h.attachHealth(r, details)
+
+	api.RespondWithJSON(w, http.StatusOK, details)
+}
+
+// HandleResolveSelection aplica operações de pasta (selecionar/remover tudo
+// abaixo de um caminho) sobre uma seleção e retorna os índices resultantes
+func (h *TorrentHandler) HandleResolveSelection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MagnetLink      string                `json:"magnet_link"`
+		SelectedIndices []int                 `json:"selected_indices"`
+		Operations      []downloader.FolderOp `json:"operations"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if err := api.ValidateMagnetLink(req.MagnetLink); err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Normalmente já está em cache pela análise feita antes da seleção
+	details, err := h.deps.TorrentService.AnalyzeMagnetContext(r.Context(), req.MagnetLink, nil)
+	if err != nil {
+		logger.Error("failed to get torrent info: %v", err)
+		api.RespondWithError(w, http.StatusInternalServerError, "failed to analyze torrent")
+		return
+	}
+
+	indices, err := downloader.ApplyFolderOps(details.Files, req.SelectedIndices, req.Operations)
+	if err != nil {
+		api.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"selected_indices": indices,
+	}
+	if want, _ := strconv.ParseBool(r.URL.Query().Get("tree")); want {
+		response["tree"] = downloader.BuildFileTree(details.Files, indices)
+	}
+	api.RespondWithJSON(w, http.StatusOK, response)
 }
 
 // HandleSetFilePriority define a prioridade de um arquivo
@@ -13,6 +13,9 @@ type Dependencies struct {
 	TorrentService  *downloader.Service
 	Persistence     *downloader.PersistenceManager
 	ProgressHub     ProgressBroadcaster
+	AnalysisJobs    *manager.AnalysisJobs
+	// AppDataDir é o diretório de dados da aplicação (config, API key)
+	AppDataDir string
 }
 
 // ProgressBroadcaster interface para broadcast de progresso
@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,10 +28,14 @@ var (
 		ERROR: "ERROR",
 		FATAL: "FATAL",
 	}
-	currentLevel = INFO
+	currentLevel atomic.Int32
 	logFile      *os.File
 )
 
+func init() {
+	currentLevel.Store(int32(INFO))
+}
+
 func Init(logDir string) error {
 	if logDir == "" {
 		logDir = "logs"
@@ -53,7 +59,17 @@ func Init(logDir string) error {
 }
 
 func SetLevel(level Level) {
-	currentLevel = level
+	currentLevel.Store(int32(level))
+}
+
+// ParseLevel converte um nome como "debug" ou "WARN" em Level.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return INFO, fmt.Errorf("unknown log level: %q", name)
 }
 
 func Close() {
@@ -63,7 +79,7 @@ func Close() {
 }
 
 func logMessage(level Level, format string, v ...interface{}) {
-	if level < currentLevel {
+	if level < Level(currentLevel.Load()) {
 		return
 	}
 
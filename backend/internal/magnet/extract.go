@@ -0,0 +1,53 @@
+package magnet
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var magnetPattern = regexp.MustCompile(`(?i)magnet:\?[^\s"'<>]+`)
+
+// Extracted é um magnet encontrado num texto.
+type Extracted struct {
+	// Input é o trecho original encontrado no texto
+	Input  string
+	Magnet *Magnet
+}
+
+// Extract encontra magnet links e info hashes soltos em text, na ordem em
+// que aparecem, descartando repetições do mesmo info hash. Trechos que
+// parecem magnets mas não são válidos voltam em invalid.
+func Extract(text string) (found []Extracted, invalid []string) {
+	seen := make(map[string]bool)
+	add := func(input string) {
+		m, err := Parse(input)
+		if err != nil {
+			invalid = append(invalid, input)
+			return
+		}
+		if seen[m.InfoHash()] {
+			return
+		}
+		seen[m.InfoHash()] = true
+		found = append(found, Extracted{Input: input, Magnet: m})
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		for _, loc := range magnetPattern.FindAllStringIndex(line, -1) {
+			add(strings.TrimRight(line[loc[0]:loc[1]], ".,;)]}"))
+		}
+		// Hashes soltos precisam ser palavras inteiras para não casar com
+		// trechos de URLs ou de outros identificadores
+		rest := magnetPattern.ReplaceAllString(line, " ")
+		words := strings.FieldsFunc(rest, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if (&Magnet{}).setBareHash(word) == nil {
+				add(word)
+			}
+		}
+	}
+	return found, invalid
+}
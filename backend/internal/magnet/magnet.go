@@ -0,0 +1,293 @@
+// Package magnet interpreta magnet links e info hashes soltos, reduzindo
+// todas as formas aceitas a um info hash canônico.
+package magnet
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	btihPrefix = "urn:btih:"
+	btmhPrefix = "urn:btmh:"
+
+	// Multihash SHA2-256 com 32 bytes, o único usado pelo BitTorrent v2.
+	sha256Multihash = "1220"
+)
+
+var (
+	ErrEmpty           = errors.New("magnet link cannot be empty")
+	ErrInvalidFormat   = errors.New("invalid magnet link format")
+	ErrMissingInfoHash = errors.New("magnet link missing info hash")
+	ErrInvalidInfoHash = errors.New("invalid info hash")
+)
+
+// Param é um parâmetro do magnet que o parser não interpreta. É mantido na
+// ordem original para que String() não perca informação.
+type Param struct {
+	Key   string
+	Value string
+}
+
+type Magnet struct {
+	// InfoHashV1 é o SHA-1 do info dict (40 hex minúsculos), vazio em
+	// magnets somente v2.
+	InfoHashV1 string
+	// InfoHashV2 é o SHA-256 do info dict (64 hex minúsculos), vazio em
+	// magnets somente v1.
+	InfoHashV2 string
+
+	DisplayName string
+	Trackers    []string
+	WebSeeds    []string
+	ExactLength int64
+
+	Extra []Param
+}
+
+// Parse aceita magnet links (btih em hex ou base32, btmh ou ambos) e info
+// hashes colados sozinhos.
+func Parse(input string) (*Magnet, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, ErrEmpty
+	}
+
+	if !hasMagnetPrefix(input) {
+		m := &Magnet{}
+		if err := m.setBareHash(input); err != nil {
+			return nil, ErrInvalidFormat
+		}
+		return m, nil
+	}
+
+	m := &Magnet{}
+	for _, part := range strings.Split(input[len("magnet:?"):], "&") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+
+		switch strings.ToLower(key) {
+		case "xt":
+			if err := m.setExactTopic(value); err != nil {
+				return nil, err
+			}
+		case "dn":
+			if m.DisplayName == "" {
+				m.DisplayName = value
+			}
+		case "tr":
+			m.Trackers = appendUnique(m.Trackers, value)
+		case "ws":
+			m.WebSeeds = appendUnique(m.WebSeeds, value)
+		case "xl":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid exact length: %q", value)
+			}
+			m.ExactLength = n
+		default:
+			m.Extra = append(m.Extra, Param{Key: key, Value: value})
+		}
+	}
+
+	if m.InfoHashV1 == "" && m.InfoHashV2 == "" {
+		return nil, ErrMissingInfoHash
+	}
+	return m, nil
+}
+
+// InfoHash normaliza um magnet ou hash solto e retorna o info hash canônico.
+func InfoHash(input string) (string, error) {
+	m, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return m.InfoHash(), nil
+}
+
+// Normalize reescreve input como magnet link canônico.
+func Normalize(input string) (string, error) {
+	m, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return m.String(), nil
+}
+
+// InfoHash retorna o identificador canônico: o hash v1 quando existe (é o
+// que o swarm usa em torrents híbridos), senão o hash v2.
+func (m *Magnet) InfoHash() string {
+	if m.InfoHashV1 != "" {
+		return m.InfoHashV1
+	}
+	return m.InfoHashV2
+}
+
+// HasV1 indica se o magnet pode ser baixado por clientes somente v1.
+func (m *Magnet) HasV1() bool {
+	return m.InfoHashV1 != ""
+}
+
+// Version retorna "v1", "v2" ou "hybrid".
+func (m *Magnet) Version() string {
+	switch {
+	case m.InfoHashV1 != "" && m.InfoHashV2 != "":
+		return "hybrid"
+	case m.InfoHashV2 != "":
+		return "v2"
+	default:
+		return "v1"
+	}
+}
+
+func (m *Magnet) String() string {
+	var b strings.Builder
+	b.WriteString("magnet:?")
+
+	sep := ""
+	write := func(key, value string) {
+		b.WriteString(sep)
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(value)
+		sep = "&"
+	}
+
+	// urn:btih: fica sem escape; alguns clientes não aceitam a forma escapada
+	if m.InfoHashV1 != "" {
+		write("xt", btihPrefix+m.InfoHashV1)
+	}
+	if m.InfoHashV2 != "" {
+		write("xt", btmhPrefix+sha256Multihash+m.InfoHashV2)
+	}
+	if m.DisplayName != "" {
+		write("dn", url.QueryEscape(m.DisplayName))
+	}
+	if m.ExactLength > 0 {
+		write("xl", strconv.FormatInt(m.ExactLength, 10))
+	}
+	for _, tr := range m.Trackers {
+		write("tr", url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		write("ws", url.QueryEscape(ws))
+	}
+	for _, p := range m.Extra {
+		write(p.Key, url.QueryEscape(p.Value))
+	}
+	return b.String()
+}
+
+func (m *Magnet) setExactTopic(xt string) error {
+	lower := strings.ToLower(xt)
+	switch {
+	case strings.HasPrefix(lower, btihPrefix):
+		hash, err := parseV1(xt[len(btihPrefix):])
+		if err != nil {
+			return err
+		}
+		if m.InfoHashV1 != "" && m.InfoHashV1 != hash {
+			return errors.New("magnet link has conflicting btih hashes")
+		}
+		m.InfoHashV1 = hash
+	case strings.HasPrefix(lower, btmhPrefix):
+		hash, err := parseMultihash(xt[len(btmhPrefix):])
+		if err != nil {
+			return err
+		}
+		if m.InfoHashV2 != "" && m.InfoHashV2 != hash {
+			return errors.New("magnet link has conflicting btmh hashes")
+		}
+		m.InfoHashV2 = hash
+	default:
+		// Outras URNs (ed2k, sha1...) não identificam o torrent
+		m.Extra = append(m.Extra, Param{Key: "xt", Value: xt})
+	}
+	return nil
+}
+
+func (m *Magnet) setBareHash(s string) error {
+	switch len(s) {
+	case 40, 32:
+		hash, err := parseV1(s)
+		if err != nil {
+			return err
+		}
+		m.InfoHashV1 = hash
+	case 64:
+		if !isHex(s) {
+			return ErrInvalidInfoHash
+		}
+		m.InfoHashV2 = strings.ToLower(s)
+	case 68:
+		hash, err := parseMultihash(s)
+		if err != nil {
+			return err
+		}
+		m.InfoHashV2 = hash
+	default:
+		return ErrInvalidInfoHash
+	}
+	return nil
+}
+
+// parseV1 aceita o hash v1 em hex (40) ou base32 (32) e retorna hex.
+func parseV1(s string) (string, error) {
+	switch len(s) {
+	case 40:
+		if !isHex(s) {
+			return "", ErrInvalidInfoHash
+		}
+		return strings.ToLower(s), nil
+	case 32:
+		raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(s))
+		if err != nil || len(raw) != 20 {
+			return "", ErrInvalidInfoHash
+		}
+		return hex.EncodeToString(raw), nil
+	default:
+		return "", fmt.Errorf("%w: expected 40 hex or 32 base32 characters, got %d", ErrInvalidInfoHash, len(s))
+	}
+}
+
+func parseMultihash(s string) (string, error) {
+	if len(s) != len(sha256Multihash)+64 || !isHex(s) {
+		return "", fmt.Errorf("%w: btmh must be a sha2-256 multihash", ErrInvalidInfoHash)
+	}
+	if !strings.EqualFold(s[:len(sha256Multihash)], sha256Multihash) {
+		return "", fmt.Errorf("%w: unsupported multihash function", ErrInvalidInfoHash)
+	}
+	return strings.ToLower(s[len(sha256Multihash):]), nil
+}
+
+func hasMagnetPrefix(s string) bool {
+	return len(s) >= len("magnet:?") && strings.EqualFold(s[:len("magnet:?")], "magnet:?")
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, existing := range list {
+		if existing == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
@@ -0,0 +1,251 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/logger"
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/swarm"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// JobRetention é quanto tempo um job finalizado continua consultável.
+	JobRetention = 30 * time.Minute
+	// MaxRunningJobs limita as análises simultâneas; os demais jobs ficam
+	// pendentes até abrir uma vaga.
+	MaxRunningJobs = 4
+
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+
+	StageMetadata = "fetching_metadata"
+	StageHealth   = "checking_health"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// EventPublisher envia eventos de um job para os clientes SSE.
+type EventPublisher func(id string, data map[string]interface{})
+
+type AnalysisJob struct {
+	ID         string                     `json:"id"`
+	Status     string                     `json:"status"`
+	Stage      string                     `json:"stage,omitempty"`
+	Peers      int                        `json:"peers"`
+	MagnetLink string                     `json:"magnet_link"`
+	InfoHash   string                     `json:"info_hash"`
+	Result     *downloader.TorrentDetails `json:"result,omitempty"`
+	Error      string                     `json:"error,omitempty"`
+	CreatedAt  time.Time                  `json:"created_at"`
+	FinishedAt *time.Time                 `json:"finished_at,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// AnalysisOptions controla o que um job de análise faz além dos metadados.
+type AnalysisOptions struct {
+	Health        bool
+	HealthTimeout time.Duration
+}
+
+// AnalysisJobs executa análises de magnet em segundo plano. O cancelamento
+// interrompe a espera pelos metadados e remove o torrent do cliente.
+type AnalysisJobs struct {
+	service *downloader.Service
+	publish EventPublisher
+	jobs    map[string]*AnalysisJob
+	slots   chan struct{}
+	mu      sync.Mutex
+}
+
+func NewAnalysisJobs(service *downloader.Service, publish EventPublisher) *AnalysisJobs {
+	return &AnalysisJobs{
+		service: service,
+		publish: publish,
+		jobs:    make(map[string]*AnalysisJob),
+		slots:   make(chan struct{}, MaxRunningJobs),
+	}
+}
+
+// Submit valida o magnet e inicia a análise, retornando o job criado.
+func (aj *AnalysisJobs) Submit(magnetLink string, opts AnalysisOptions) (*AnalysisJob, error) {
+	m, err := magnet.Parse(magnetLink)
+	if err != nil {
+		return nil, err
+	}
+	if !m.HasV1() {
+		return nil, downloader.ErrV2Only
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &AnalysisJob{
+		ID:         uuid.New().String(),
+		Status:     JobPending,
+		MagnetLink: m.String(),
+		InfoHash:   m.InfoHash(),
+		CreatedAt:  time.Now(),
+		cancel:     cancel,
+	}
+
+	aj.mu.Lock()
+	aj.prune()
+	aj.jobs[job.ID] = job
+	aj.mu.Unlock()
+
+	go aj.run(ctx, job, opts)
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+func (aj *AnalysisJobs) run(ctx context.Context, job *AnalysisJob, opts AnalysisOptions) {
+	defer job.cancel()
+
+	var details *downloader.TorrentDetails
+	var err error
+	select {
+	case aj.slots <- struct{}{}:
+		defer func() { <-aj.slots }()
+
+		aj.update(job, func(j *AnalysisJob) {
+			j.Status = JobRunning
+			j.Stage = StageMetadata
+		})
+
+		details, err = aj.service.AnalyzeMagnetContext(ctx, job.MagnetLink, func(peers int) {
+			aj.update(job, func(j *AnalysisJob) { j.Peers = peers })
+		})
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err == nil && opts.Health {
+		aj.update(job, func(j *AnalysisJob) { j.Stage = StageHealth })
+		checker := &swarm.Checker{DHT: aj.service}
+		if health, herr := checker.Check(ctx, details.InfoHash, details.Trackers(), opts.HealthTimeout); herr == nil {
+			details.Health = health
+		} else {
+			logger.Warn("job %s: swarm health check failed: %v", job.ID, herr)
+		}
+	}
+
+	aj.update(job, func(j *AnalysisJob) {
+		now := time.Now()
+		j.FinishedAt = &now
+		j.Stage = ""
+		switch {
+		case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+			j.Status = JobCanceled
+		case err != nil:
+			j.Status = JobFailed
+			j.Error = err.Error()
+		default:
+			j.Status = JobCompleted
+			j.Result = details
+		}
+	})
+}
+
+// update aplica fn ao job e publica o novo estado.
+func (aj *AnalysisJobs) update(job *AnalysisJob, fn func(j *AnalysisJob)) {
+	aj.mu.Lock()
+	fn(job)
+	snapshot := *job
+	aj.mu.Unlock()
+
+	if aj.publish == nil {
+		return
+	}
+	event := map[string]interface{}{
+		"type":   "job",
+		"status": snapshot.Status,
+		"stage":  snapshot.Stage,
+		"peers":  snapshot.Peers,
+	}
+	if snapshot.Error != "" {
+		event["error"] = snapshot.Error
+	}
+	if snapshot.Result != nil {
+		event["result"] = snapshot.Result
+	}
+	aj.publish(snapshot.ID, event)
+}
+
+func (aj *AnalysisJobs) Get(id string) (*AnalysisJob, error) {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+
+	job, ok := aj.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// List retorna os jobs do mais recente para o mais antigo.
+func (aj *AnalysisJobs) List() []*AnalysisJob {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+
+	aj.prune()
+	list := make([]*AnalysisJob, 0, len(aj.jobs))
+	for _, job := range aj.jobs {
+		snapshot := *job
+		list = append(list, &snapshot)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Cancel interrompe um job em andamento. Jobs já finalizados são apenas
+// removidos da lista.
+func (aj *AnalysisJobs) Cancel(id string) error {
+	aj.mu.Lock()
+	job, ok := aj.jobs[id]
+	if !ok {
+		aj.mu.Unlock()
+		return ErrJobNotFound
+	}
+	finished := job.FinishedAt != nil
+	if finished {
+		delete(aj.jobs, id)
+	}
+	aj.mu.Unlock()
+
+	if !finished {
+		job.cancel()
+	}
+	return nil
+}
+
+// Shutdown cancela todos os jobs em andamento.
+func (aj *AnalysisJobs) Shutdown() {
+	aj.mu.Lock()
+	defer aj.mu.Unlock()
+
+	for _, job := range aj.jobs {
+		job.cancel()
+	}
+}
+
+// prune remove jobs finalizados há mais de JobRetention. Chamado com mu travado.
+func (aj *AnalysisJobs) prune() {
+	for id, job := range aj.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > JobRetention {
+			delete(aj.jobs, id)
+		}
+	}
+}
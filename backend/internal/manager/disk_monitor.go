@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"nebula/backend/internal/config"
+	"nebula/backend/internal/fileutil"
+	"nebula/backend/internal/logger"
+)
+
+const DiskCheckInterval = 30 * time.Second
+
+// DiskMonitor pausa todos os downloads quando o espaço livre no diretório
+// de dados cai abaixo de AppConfig.LowSpaceThreshold e retoma os que pausou
+// quando o espaço volta a ficar 10% acima do limite.
+type DiskMonitor struct {
+	dm         *DownloadManager
+	config     *config.ConfigManager
+	notify     func(event string, data map[string]interface{})
+	autoPaused map[string]bool
+	low        bool
+}
+
+func NewDiskMonitor(dm *DownloadManager, cm *config.ConfigManager, notify func(event string, data map[string]interface{})) *DiskMonitor {
+	return &DiskMonitor{
+		dm:         dm,
+		config:     cm,
+		notify:     notify,
+		autoPaused: make(map[string]bool),
+	}
+}
+
+func (m *DiskMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(DiskCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		m.check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *DiskMonitor) check() {
+	threshold := m.config.Get().LowSpaceThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	dir := m.dm.service.DataDir()
+	usage, err := fileutil.FreeSpace(dir)
+	if err != nil {
+		logger.Warn("disk monitor: failed to check free space for %s: %v", dir, err)
+		return
+	}
+
+	switch {
+	case usage.Free < threshold:
+		var paused []string
+		for _, id := range m.dm.ActiveIDs() {
+			session, ok := m.dm.GetSession(id)
+			if !ok || session.PauseManager.IsPaused() {
+				continue
+			}
+			if err := m.dm.PauseDownload(id); err == nil {
+				m.autoPaused[id] = true
+				paused = append(paused, id)
+			}
+		}
+
+		if !m.low || len(paused) > 0 {
+			logger.Warn("low disk space on %s: %d bytes free (threshold %d), paused %d downloads", dir, usage.Free, threshold, len(paused))
+			m.notify("disk_low", map[string]interface{}{
+				"path":      dir,
+				"free":      usage.Free,
+				"total":     usage.Total,
+				"threshold": threshold,
+				"paused":    paused,
+			})
+		}
+		m.low = true
+
+	case m.low && usage.Free >= threshold+threshold/10:
+		var resumed []string
+		for id := range m.autoPaused {
+			if err := m.dm.ResumeDownload(id); err == nil {
+				resumed = append(resumed, id)
+			}
+		}
+		m.autoPaused = make(map[string]bool)
+		m.low = false
+
+		logger.Info("disk space recovered on %s: %d bytes free, resumed %d downloads", dir, usage.Free, len(resumed))
+		m.notify("disk_ok", map[string]interface{}{
+			"path":    dir,
+			"free":    usage.Free,
+			"total":   usage.Total,
+			"resumed": resumed,
+		})
+	}
+}
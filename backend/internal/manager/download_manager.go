@@ -4,9 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"sync"
+	"time"
 
+	"nebula/backend/internal/config"
 	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/logger"
+	"nebula/backend/internal/magnet"
+	"nebula/backend/internal/postprocess"
+	"nebula/backend/internal/selection"
 
 	"github.com/google/uuid"
 )
@@ -16,47 +23,159 @@ type DownloadManager struct {
 	pauseManagers map[string]*downloader.PauseManager
 	service       *downloader.Service
 	persistence   *downloader.PersistenceManager
+	config        *config.ConfigManager
 	mu            sync.Mutex
 }
 
+// SelectionAll seleciona todos os arquivos do torrent.
+const SelectionAll = "all"
+
+// DownloadOptions agrupa as opções de um download além da seleção de arquivos.
+type DownloadOptions struct {
+	OnComplete []postprocess.Action
+	// ExtractArchives sobrepõe AppConfig.AutoExtract quando definido.
+	ExtractArchives *bool
+	// SelectionPolicy escolhe os arquivos depois dos metadados quando o
+	// download é iniciado sem índices (ex.: adição em lote).
+	SelectionPolicy string
+	// Rules filtra os índices informados (ou todos os arquivos, quando não
+	// há índices) depois que os metadados chegam.
+	Rules *selection.Rules
+	// Transfer define limites de velocidade e meta de seeding do download.
+	Transfer downloader.TransferOptions
+	// Private não registra o download no histórico.
+	Private bool
+	// Record é o registro inicial de um download novo. É gravado antes de o
+	// download começar, para que as atualizações feitas por ele não sejam
+	// sobrescritas.
+	Record *downloader.DownloadRecord
+}
+
+// resolveSelection aplica a política de seleção à lista de arquivos.
+func resolveSelection(policy string, files []downloader.FileMetadata) ([]int, error) {
+	switch policy {
+	case SelectionAll:
+		indices := make([]int, len(files))
+		for i, f := range files {
+			indices[i] = f.Index
+		}
+		return indices, nil
+	default:
+		return nil, fmt.Errorf("unknown selection policy: %q", policy)
+	}
+}
+
+func validateSelectionPolicy(policy string) error {
+	_, err := resolveSelection(policy, nil)
+	return err
+}
+
 type DownloadSession struct {
 	ID           string
+	InfoHash     string
 	Cancel       context.CancelFunc
 	PauseManager *downloader.PauseManager
+	// Merged são os índices juntados por MergeSelection, protegidos por
+	// DownloadManager.mu
+	Merged []int
 }
 
-func NewDownloadManager(service *downloader.Service, persistence *downloader.PersistenceManager) *DownloadManager {
+// DuplicateError é retornado ao iniciar um torrent que já está sendo baixado.
+type DuplicateError struct {
+	ExistingID string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("torrent is already being downloaded (id %s)", e.ExistingID)
+}
+
+func NewDownloadManager(service *downloader.Service, persistence *downloader.PersistenceManager, cm *config.ConfigManager) *DownloadManager {
 	return &DownloadManager{
 		sessions:      make(map[string]*DownloadSession),
 		pauseManagers: make(map[string]*downloader.PauseManager),
 		service:       service,
 		persistence:   persistence,
+		config:        cm,
 	}
 }
 
-func (dm *DownloadManager) startDownloadInternal(ctx context.Context, id string, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter downloader.ProgressReporter) (string, error) {
+func (dm *DownloadManager) startDownloadInternal(ctx context.Context, id string, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter downloader.ProgressReporter, opts DownloadOptions) (string, error) {
 	if err := downloader.ValidateMagnetLink(magnetLink); err != nil {
 		return "", fmt.Errorf("invalid magnet link: %w", err)
 	}
 
+	if opts.Rules != nil {
+		if err := opts.Rules.Validate(); err != nil {
+			return "", fmt.Errorf("invalid selection rules: %w", err)
+		}
+	}
+
 	if len(selectedIndices) == 0 {
-		return "", errors.New("no files selected")
+		if opts.SelectionPolicy == "" && opts.Rules != nil {
+			opts.SelectionPolicy = SelectionAll
+		}
+		if opts.SelectionPolicy == "" {
+			return "", errors.New("no files selected")
+		}
+		if err := validateSelectionPolicy(opts.SelectionPolicy); err != nil {
+			return "", err
+		}
 	}
 
+	if err := postprocess.ValidateActions(opts.OnComplete); err != nil {
+		return "", fmt.Errorf("invalid on_complete actions: %w", err)
+	}
+
+	if opts.Transfer.MaxDownloadSpeed < 0 || opts.Transfer.MaxUploadSpeed < 0 || opts.Transfer.SeedRatio < 0 || opts.Transfer.SeedTime < 0 {
+		return "", errors.New("transfer limits cannot be negative")
+	}
+
+	infoHash, err := magnet.InfoHash(magnetLink)
+	if err != nil {
+		return "", fmt.Errorf("invalid magnet link: %w", err)
+	}
+	// O registro guarda o diretório real, usado por delete-files e pelas
+	// ações de conclusão
+	outputDir = dm.service.DownloadDir(outputDir)
+
 	downloadCtx, cancel := context.WithCancel(context.Background())
 	pauseManager := downloader.NewPauseManager()
 
 	session := &DownloadSession{
 		ID:           id,
+		InfoHash:     infoHash,
 		Cancel:       cancel,
 		PauseManager: pauseManager,
 	}
 
 	dm.mu.Lock()
+	for _, existing := range dm.sessions {
+		if existing.InfoHash == infoHash {
+			dm.mu.Unlock()
+			cancel()
+			return "", &DuplicateError{ExistingID: existing.ID}
+		}
+	}
 	dm.sessions[id] = session
 	dm.pauseManagers[id] = pauseManager
 	dm.mu.Unlock()
 
+	// Downloads novos trazem o registro inicial; retomados já têm um gravado
+	if dm.persistence != nil {
+		record := opts.Record
+		if record == nil {
+			record, _ = dm.persistence.GetDownload(id)
+		}
+		if record != nil {
+			record.ID = id
+			record.OutputDir = outputDir
+			record.Allocation = dm.service.AllocationMode()
+			if err := dm.persistence.SaveDownload(record); err != nil {
+				logger.Warn("failed to save download record: %v", err)
+			}
+		}
+	}
+
 	go func() {
 		defer func() {
 			dm.mu.Lock()
@@ -65,7 +184,19 @@ func (dm *DownloadManager) startDownloadInternal(ctx context.Context, id string,
 			dm.mu.Unlock()
 		}()
 
-		err := dm.service.Download(downloadCtx, id, magnetLink, selectedIndices, sequential, reporter, pauseManager)
+		var result *downloader.DownloadResult
+		var err error
+		if len(selectedIndices) == 0 || opts.Rules != nil {
+			selectedIndices, err = dm.selectFiles(downloadCtx, id, magnetLink, outputDir, selectedIndices, opts)
+		}
+		if err == nil {
+			transfer := opts.Transfer
+			transfer.Private = opts.Private
+			if dm.persistence != nil {
+				transfer.OnSeeding = func() { dm.setStatus(id, "seeding") }
+			}
+			result, err = dm.service.Download(downloadCtx, id, magnetLink, outputDir, selectedIndices, sequential, reporter, pauseManager, transfer)
+		}
 
 		if dm.persistence != nil {
 			if err != nil {
@@ -79,37 +210,265 @@ func (dm *DownloadManager) startDownloadInternal(ctx context.Context, id string,
 					msg = fmt.Sprintf("Error: %s", err)
 				}
 
-				dm.persistence.SaveDownload(&downloader.DownloadRecord{
-					ID:              id,
-					MagnetLink:      magnetLink,
-					OutputDir:       outputDir,
-					SelectedIndices: selectedIndices,
-					Status:          "error",
-					ErrorMessage:    msg,
+				dm.updateRecord(id, magnetLink, outputDir, selectedIndices, func(r *downloader.DownloadRecord) {
+					r.Status = "error"
+					r.ErrorMessage = msg
 				})
 			} else {
-				dm.persistence.SaveDownload(&downloader.DownloadRecord{
-					ID:              id,
-					MagnetLink:      magnetLink,
-					OutputDir:       outputDir,
-					SelectedIndices: selectedIndices,
-					Status:          "completed",
-					Progress:        100,
+				dm.updateRecord(id, magnetLink, outputDir, selectedIndices, func(r *downloader.DownloadRecord) {
+					r.Status = "completed"
+					r.Progress = 100
+					r.TorrentName = result.Name
+					r.ErrorMessage = ""
+					r.OnComplete = opts.OnComplete
+					r.ExtractArchives = opts.ExtractArchives
 				})
+				dm.recordHistory(magnetLink, result, opts)
+				if opts.Private {
+					record, _ := dm.persistence.GetDownload(id)
+					dm.removePrivateTorrent(record)
+				}
+			}
+		}
+
+		if err == nil {
+			// Com o seeding interrompido o ctx já foi cancelado, mas o
+			// download está completo e o pós-processamento precisa rodar
+			postCtx := downloadCtx
+			if downloadCtx.Err() != nil {
+				postCtx = context.WithoutCancel(downloadCtx)
 			}
+			dm.extractArchives(postCtx, id, result, opts, reporter)
+			dm.runCompletionActions(postCtx, id, result, opts, reporter)
 		}
 	}()
 
 	return id, nil
 }
 
-func (dm *DownloadManager) StartDownload(ctx context.Context, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter downloader.ProgressReporter) (string, error) {
+// recordHistory grava o download concluído no histórico, exceto quando é
+// privado ou o histórico está desativado.
+func (dm *DownloadManager) recordHistory(magnetLink string, result *downloader.DownloadResult, opts DownloadOptions) {
+	if opts.Private || (dm.config != nil && dm.config.Get().DisableHistory) {
+		return
+	}
+	if err := dm.persistence.AddToHistory(magnetLink, result.Name, len(result.Files), result.TotalSize); err != nil {
+		logger.Warn("failed to record history: %v", err)
+	}
+}
+
+// selectFiles busca os metadados (que ficam em cache para o download),
+// resolve a política de seleção quando não há índices e aplica as regras,
+// gravando os índices escolhidos no registro.
+func (dm *DownloadManager) selectFiles(ctx context.Context, id, magnetLink, outputDir string, indices []int, opts DownloadOptions) ([]int, error) {
+	details, err := dm.service.AnalyzeMagnetContext(ctx, magnetLink, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(indices) == 0 {
+		indices, err = resolveSelection(opts.SelectionPolicy, details.Files)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Rules != nil {
+		indices = downloader.ApplyRules(details.Files, indices, opts.Rules)
+	}
+
+	if len(indices) == 0 {
+		return nil, errors.New("no files matched the selection")
+	}
+
+	if dm.persistence != nil {
+		dm.updateRecord(id, magnetLink, outputDir, indices, func(r *downloader.DownloadRecord) {
+			r.TorrentName = details.Name
+		})
+	}
+	return indices, nil
+}
+
+// updateRecord aplica fn sobre o registro persistido, preservando os campos
+// que o handler gravou ao iniciar o download.
+func (dm *DownloadManager) updateRecord(id, magnetLink, outputDir string, selectedIndices []int, fn func(r *downloader.DownloadRecord)) {
+	record, _ := dm.persistence.GetDownload(id)
+	if record == nil {
+		record = &downloader.DownloadRecord{
+			ID:        id,
+			CreatedAt: time.Now(),
+		}
+	}
+	record.MagnetLink = magnetLink
+	record.OutputDir = outputDir
+	record.SelectedIndices = dm.withMerged(id, selectedIndices)
+	fn(record)
+	dm.persistence.SaveDownload(record)
+}
+
+// withMerged acrescenta a indices os arquivos juntados ao download por
+// MergeSelection.
+func (dm *DownloadManager) withMerged(id string, indices []int) []int {
+	dm.mu.Lock()
+	var merged []int
+	if session, ok := dm.sessions[id]; ok {
+		merged = session.Merged
+	}
+	dm.mu.Unlock()
+	if len(merged) == 0 {
+		return indices
+	}
+
+	result := append([]int{}, indices...)
+	selected := make(map[int]bool, len(indices))
+	for _, idx := range indices {
+		selected[idx] = true
+	}
+	for _, idx := range merged {
+		if !selected[idx] {
+			selected[idx] = true
+			result = append(result, idx)
+		}
+	}
+	return result
+}
+
+// extractArchives extrai os arquivos compactados do download, que estão em
+// result.Dir, o diretório em que o cliente os gravou.
+func (dm *DownloadManager) extractArchives(ctx context.Context, id string, result *downloader.DownloadResult, opts DownloadOptions, reporter downloader.ProgressReporter) {
+	enabled := false
+	deleteArchives := false
+	if dm.config != nil {
+		cfg := dm.config.Get()
+		enabled = cfg.AutoExtract
+		deleteArchives = cfg.ExtractDeleteArchives
+	}
+	if opts.ExtractArchives != nil {
+		enabled = *opts.ExtractArchives
+	}
+	if !enabled {
+		return
+	}
+
+	files := make([]string, len(result.Files))
+	for i, f := range result.Files {
+		files[i] = filepath.Join(result.Dir, f)
+	}
+
+	var lastReport time.Time
+	progress := func(archive string, done, total int64) {
+		if reporter == nil || time.Since(lastReport) < time.Second {
+			return
+		}
+		lastReport = time.Now()
+		var percentage float64
+		if total > 0 {
+			percentage = float64(done) / float64(total) * 100
+		}
+		reporter.OnEvent(id, "extract", map[string]interface{}{
+			"archive":    filepath.Base(archive),
+			"percentage": percentage,
+			"done":       done,
+			"total":      total,
+		})
+	}
+
+	results := postprocess.ExtractArchives(ctx, files, deleteArchives, progress)
+	if len(results) == 0 {
+		return
+	}
+
+	for _, res := range results {
+		if res.Success {
+			logger.Info("[%s] extracted %s (%d files)", id, filepath.Base(res.Archive), res.Files)
+		} else {
+			logger.Warn("[%s] failed to extract %s: %s", id, filepath.Base(res.Archive), res.Error)
+		}
+		if reporter != nil {
+			reporter.OnEvent(id, "extract", map[string]interface{}{
+				"archive":    filepath.Base(res.Archive),
+				"percentage": 100,
+				"success":    res.Success,
+				"error":      res.Error,
+				"files":      res.Files,
+			})
+		}
+	}
+
+	if dm.persistence != nil {
+		record, _ := dm.persistence.GetDownload(id)
+		if record != nil {
+			record.ExtractResults = results
+			dm.persistence.SaveDownload(record)
+		}
+	}
+}
+
+// setStatus altera apenas o status do registro persistido.
+func (dm *DownloadManager) setStatus(id, status string) {
+	record, _ := dm.persistence.GetDownload(id)
+	if record == nil {
+		record = &downloader.DownloadRecord{ID: id}
+	}
+	record.Status = status
+	dm.persistence.SaveDownload(record)
+}
+
+// runCompletionActions executa as ações de conclusão sobre os dados em
+// result.Dir. Se um move muda o local, o registro passa a apontar para ele.
+func (dm *DownloadManager) runCompletionActions(ctx context.Context, id string, result *downloader.DownloadResult, opts DownloadOptions, reporter downloader.ProgressReporter) {
+	actions := append([]postprocess.Action{}, opts.OnComplete...)
+	if dm.config != nil {
+		actions = append(actions, dm.config.Get().OnComplete...)
+	}
+	if len(actions) == 0 {
+		return
+	}
+
+	target := &postprocess.Target{
+		ID:       id,
+		Name:     result.Name,
+		Path:     filepath.Join(result.Dir, result.Name),
+		InfoHash: result.InfoHash,
+		Size:     result.TotalSize,
+	}
+
+	originalPath := target.Path
+	results := postprocess.Run(ctx, actions, target)
+	for _, res := range results {
+		if res.Success {
+			logger.Info("[%s] on-complete %s succeeded in %.1fs", id, res.Type, res.Duration)
+		} else {
+			logger.Warn("[%s] on-complete %s failed: %s", id, res.Type, res.Error)
+		}
+		if reporter != nil {
+			if res.Success {
+				reporter.OnLog(id, fmt.Sprintf("On-complete %s: ok", res.Type))
+			} else {
+				reporter.OnLog(id, fmt.Sprintf("On-complete %s failed: %s", res.Type, res.Error))
+			}
+		}
+	}
+
+	if dm.persistence != nil {
+		record, _ := dm.persistence.GetDownload(id)
+		if record != nil {
+			record.ActionResults = results
+			if target.Path != originalPath {
+				record.OutputDir = filepath.Dir(target.Path)
+			}
+			dm.persistence.SaveDownload(record)
+		}
+	}
+}
+
+func (dm *DownloadManager) StartDownload(ctx context.Context, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter downloader.ProgressReporter, opts DownloadOptions) (string, error) {
 	id := uuid.New().String()
-	return dm.startDownloadInternal(ctx, id, magnetLink, outputDir, selectedIndices, sequential, reporter)
+	return dm.startDownloadInternal(ctx, id, magnetLink, outputDir, selectedIndices, sequential, reporter, opts)
 }
 
-func (dm *DownloadManager) StartDownloadWithID(ctx context.Context, id string, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter downloader.ProgressReporter) (string, error) {
-	return dm.startDownloadInternal(ctx, id, magnetLink, outputDir, selectedIndices, sequential, reporter)
+func (dm *DownloadManager) StartDownloadWithID(ctx context.Context, id string, magnetLink string, outputDir string, selectedIndices []int, sequential bool, reporter downloader.ProgressReporter, opts DownloadOptions) (string, error) {
+	return dm.startDownloadInternal(ctx, id, magnetLink, outputDir, selectedIndices, sequential, reporter, opts)
 }
 
 func (dm *DownloadManager) CancelDownload(id string) error {
@@ -137,10 +496,7 @@ func (dm *DownloadManager) PauseDownload(id string) error {
 	pauseManager.Pause()
 
 	if dm.persistence != nil {
-		dm.persistence.SaveDownload(&downloader.DownloadRecord{
-			ID:     id,
-			Status: "paused",
-		})
+		dm.setStatus(id, "paused")
 	}
 
 	return nil
@@ -158,10 +514,7 @@ func (dm *DownloadManager) ResumeDownload(id string) error {
 	pauseManager.Resume()
 
 	if dm.persistence != nil {
-		dm.persistence.SaveDownload(&downloader.DownloadRecord{
-			ID:     id,
-			Status: "downloading",
-		})
+		dm.setStatus(id, "downloading")
 	}
 
 	return nil
@@ -176,13 +529,97 @@ func (dm *DownloadManager) DeleteDownload(id string) error {
 		session.Cancel()
 	}
 
-	if dm.persistence != nil {
-		return dm.persistence.DeleteDownload(id)
+	if dm.persistence == nil {
+		return nil
+	}
+	record, _ := dm.persistence.GetDownload(id)
+	if err := dm.persistence.DeleteDownload(id); err != nil {
+		return err
+	}
+	if record != nil && record.Private {
+		dm.removePrivateTorrent(record)
+	}
+	return nil
+}
+
+// removePrivateTorrent apaga o .torrent guardado de um download privado, a
+// menos que outro download do mesmo torrent ainda o use.
+func (dm *DownloadManager) removePrivateTorrent(record *downloader.DownloadRecord) {
+	if record == nil || record.InfoHash == "" {
+		return
+	}
+	records, _ := dm.persistence.GetAllDownloads()
+	for _, r := range records {
+		if r.ID != record.ID && r.InfoHash == record.InfoHash {
+			return
+		}
+	}
+	if err := dm.service.RemoveTorrent(record.InfoHash); err != nil {
+		logger.Warn("failed to remove torrent %s: %v", record.InfoHash, err)
+	}
+}
+
+// FindActive retorna o download em andamento do torrent com infoHash.
+func (dm *DownloadManager) FindActive(infoHash string) (string, bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	for _, session := range dm.sessions {
+		if session.InfoHash == infoHash {
+			return session.ID, true
+		}
+	}
+	return "", false
+}
+
+// MergeSelection adiciona arquivos à seleção de um download em andamento.
+func (dm *DownloadManager) MergeSelection(id string, indices []int) error {
+	dm.mu.Lock()
+	session, exists := dm.sessions[id]
+	dm.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("download not found: %s", id)
+	}
+
+	if err := dm.service.AddToSelection(session.InfoHash, indices); err != nil {
+		return err
 	}
 
+	dm.mu.Lock()
+	session.Merged = append(session.Merged, indices...)
+	dm.mu.Unlock()
+
+	if dm.persistence != nil {
+		if record, _ := dm.persistence.GetDownload(id); record != nil {
+			selected := make(map[int]bool, len(record.SelectedIndices))
+			for _, idx := range record.SelectedIndices {
+				selected[idx] = true
+			}
+			for _, idx := range indices {
+				if !selected[idx] {
+					selected[idx] = true
+					record.SelectedIndices = append(record.SelectedIndices, idx)
+				}
+			}
+			dm.persistence.SaveDownload(record)
+		}
+	}
 	return nil
 }
 
+// ActiveIDs retorna os downloads em andamento, incluindo os pausados.
+func (dm *DownloadManager) ActiveIDs() []string {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	ids := make([]string, 0, len(dm.sessions))
+	for id := range dm.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (dm *DownloadManager) GetSession(id string) (*DownloadSession, bool) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
@@ -4,16 +4,20 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+
+	"nebula/backend/internal/fileutil"
 )
 
 var (
 	apiKey     string
 	apiKeyOnce sync.Once
+	apiKeyMu   sync.RWMutex
 )
 
 func InitAPIKey(appDataDir string) (string, error) {
@@ -58,9 +62,27 @@ func VerifyAPIKey(providedKey, storedKey string) bool {
 }
 
 func GetAPIKey() string {
+	apiKeyMu.RLock()
+	defer apiKeyMu.RUnlock()
 	return apiKey
 }
 
+// SetAPIKey grava key em appDataDir e passa a exigi-la imediatamente.
+func SetAPIKey(appDataDir, key string) error {
+	key = strings.TrimSpace(key)
+	if len(key) < 32 {
+		return fmt.Errorf("api key must have at least 32 characters")
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(appDataDir, ".api_key"), []byte(key), 0600); err != nil {
+		return err
+	}
+
+	apiKeyMu.Lock()
+	apiKey = key
+	apiKeyMu.Unlock()
+	return nil
+}
+
 func APIKeyAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/health" || r.URL.Path == "/metrics" || r.URL.Path == "/api/progress" {
@@ -81,7 +103,7 @@ func APIKeyAuth(next http.Handler) http.Handler {
 			}
 		}
 		
-		if providedKey == "" || providedKey != apiKey {
+		if providedKey == "" || providedKey != GetAPIKey() {
 			http.Error(w, "Unauthorized: Invalid or missing API key", http.StatusUnauthorized)
 			return
 		}
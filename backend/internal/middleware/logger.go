@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// redactedParams são parâmetros de query que podem conter magnet links
+var redactedParams = []string{"magnet_link", "magnet", "info_hash"}
+
+// RequestLogger é o middleware.Logger do chi sem magnet links na URL
+// registrada, para que downloads privados não fiquem nos logs.
+var RequestLogger = chimiddleware.RequestLogger(&redactingFormatter{
+	LogFormatter: &chimiddleware.DefaultLogFormatter{
+		Logger:  log.New(os.Stdout, "", log.LstdFlags),
+		NoColor: false,
+	},
+})
+
+type redactingFormatter struct {
+	chimiddleware.LogFormatter
+}
+
+func (f *redactingFormatter) NewLogEntry(r *http.Request) chimiddleware.LogEntry {
+	return f.LogFormatter.NewLogEntry(redactRequest(r))
+}
+
+// redactRequest retorna uma cópia rasa de r com os valores sensíveis da query
+// trocados por "REDACTED". Só a cópia vai para o log.
+func redactRequest(r *http.Request) *http.Request {
+	if r.URL.RawQuery == "" {
+		return r
+	}
+
+	query := r.URL.Query()
+	changed := false
+	for key, values := range query {
+		for i, v := range values {
+			if isRedactedParam(key) || strings.HasPrefix(strings.ToLower(v), "magnet:") {
+				values[i] = "REDACTED"
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return r
+	}
+
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	clone := *r
+	clone.URL = &u
+	clone.RequestURI = u.RequestURI()
+	return &clone
+}
+
+func isRedactedParam(key string) bool {
+	for _, p := range redactedParams {
+		if strings.EqualFold(key, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -18,6 +18,12 @@ func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
 	}
 }
 
+// SetLimit altera o limite e a rajada sem descartar o limiter.
+func (rl *RateLimiter) SetLimit(r rate.Limit, b int) {
+	rl.limiter.SetLimit(r)
+	rl.limiter.SetBurst(b)
+}
+
 func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !rl.limiter.Allow() {
@@ -72,6 +78,19 @@ func (i *IPRateLimiter) cleanup() {
 	}
 }
 
+// SetLimit altera o limite e a rajada de cada IP, inclusive dos já vistos.
+func (i *IPRateLimiter) SetLimit(r rate.Limit, b int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.r = r
+	i.b = b
+	for _, entry := range i.ips {
+		entry.limiter.SetLimit(r)
+		entry.limiter.SetBurst(b)
+	}
+}
+
 func (i *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
 	i.mu.Lock()
 	defer i.mu.Unlock()
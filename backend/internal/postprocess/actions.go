@@ -0,0 +1,217 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultActionTimeout = 60 * time.Second
+	MaxActionTimeout     = 30 * time.Minute
+	maxOutputSize        = 4 << 10
+)
+
+type ActionType string
+
+const (
+	ActionCommand ActionType = "command"
+	ActionWebhook ActionType = "webhook"
+	ActionMove    ActionType = "move"
+	ActionCopy    ActionType = "copy"
+)
+
+// Action descreve uma ação executada quando um download termina.
+// Command, Args, URL e Destination aceitam os placeholders {name}, {path},
+// {infohash} e {size}.
+type Action struct {
+	Type        ActionType        `json:"type"`
+	Command     string            `json:"command,omitempty"`
+	Args        []string          `json:"args,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Destination string            `json:"destination,omitempty"`
+	Rules       []MoveRule        `json:"rules,omitempty"`
+	Timeout     int               `json:"timeout,omitempty"` // segundos
+}
+
+// Target identifica o download concluído sobre o qual as ações atuam.
+type Target struct {
+	ID       string
+	Name     string
+	Path     string
+	InfoHash string
+	Size     int64
+}
+
+type Result struct {
+	Type       ActionType `json:"type"`
+	Success    bool       `json:"success"`
+	Output     string     `json:"output,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Duration   float64    `json:"duration"` // segundos
+	FinishedAt time.Time  `json:"finished_at"`
+}
+
+func (a *Action) Validate() error {
+	switch a.Type {
+	case ActionCommand:
+		if strings.TrimSpace(a.Command) == "" {
+			return errors.New("command action requires a command")
+		}
+	case ActionWebhook:
+		if !strings.HasPrefix(a.URL, "http://") && !strings.HasPrefix(a.URL, "https://") {
+			return errors.New("webhook action requires an http(s) url")
+		}
+	case ActionMove, ActionCopy:
+		if a.Destination == "" && len(a.Rules) == 0 {
+			return fmt.Errorf("%s action requires a destination or rules", a.Type)
+		}
+		for i, rule := range a.Rules {
+			if rule.Destination == "" {
+				return fmt.Errorf("rule %d has no destination", i)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action type: %q", a.Type)
+	}
+
+	if a.Timeout < 0 || time.Duration(a.Timeout)*time.Second > MaxActionTimeout {
+		return fmt.Errorf("timeout must be between 0 and %d seconds", int(MaxActionTimeout.Seconds()))
+	}
+	return nil
+}
+
+func ValidateActions(actions []Action) error {
+	for i := range actions {
+		if err := actions[i].Validate(); err != nil {
+			return fmt.Errorf("action %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (a *Action) timeout() time.Duration {
+	if a.Timeout <= 0 {
+		return DefaultActionTimeout
+	}
+	return time.Duration(a.Timeout) * time.Second
+}
+
+// Run executa as ações em ordem. Uma ação que falha não interrompe as
+// seguintes; move altera Target.Path para que as próximas ações vejam o
+// novo local.
+func Run(ctx context.Context, actions []Action, target *Target) []Result {
+	results := make([]Result, 0, len(actions))
+	for i := range actions {
+		action := &actions[i]
+		start := time.Now()
+
+		actionCtx, cancel := context.WithTimeout(ctx, action.timeout())
+		output, err := runAction(actionCtx, action, target)
+		cancel()
+
+		result := Result{
+			Type:       action.Type,
+			Success:    err == nil,
+			Output:     truncate(output),
+			Duration:   time.Since(start).Seconds(),
+			FinishedAt: time.Now(),
+		}
+		if err != nil {
+			if errors.Is(actionCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("timed out after %s: %w", action.timeout(), err)
+			}
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func runAction(ctx context.Context, action *Action, target *Target) (string, error) {
+	switch action.Type {
+	case ActionCommand:
+		return runCommand(ctx, action, target)
+	case ActionWebhook:
+		return runWebhook(ctx, action, target)
+	case ActionMove, ActionCopy:
+		return transfer(ctx, action, target)
+	default:
+		return "", fmt.Errorf("unknown action type: %q", action.Type)
+	}
+}
+
+func runCommand(ctx context.Context, action *Action, target *Target) (string, error) {
+	args := make([]string, len(action.Args))
+	for i, arg := range action.Args {
+		args[i] = expand(arg, target)
+	}
+
+	cmd := exec.CommandContext(ctx, expand(action.Command, target), args...)
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("run command: %w", err)
+	}
+	return string(output), nil
+}
+
+func runWebhook(ctx context.Context, action *Action, target *Target) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":        "download.completed",
+		"id":           target.ID,
+		"name":         target.Name,
+		"path":         target.Path,
+		"info_hash":    target.InfoHash,
+		"size":         target.Size,
+		"completed_at": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, expand(action.URL, target), bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Nebula")
+	for k, v := range action.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.Status, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.Status, nil
+}
+
+func expand(s string, target *Target) string {
+	return strings.NewReplacer(
+		"{name}", target.Name,
+		"{path}", target.Path,
+		"{infohash}", target.InfoHash,
+		"{size}", strconv.FormatInt(target.Size, 10),
+	).Replace(s)
+}
+
+func truncate(s string) string {
+	if len(s) <= maxOutputSize {
+		return s
+	}
+	return s[:maxOutputSize] + "... (truncated)"
+}
@@ -0,0 +1,576 @@
+package postprocess
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// ExtractProgress recebe o progresso da extração de um arquivo compactado.
+type ExtractProgress func(archive string, done, total int64)
+
+type ExtractResult struct {
+	Archive     string    `json:"archive"`
+	Destination string    `json:"destination,omitempty"`
+	Volumes     int       `json:"volumes"`
+	Files       int       `json:"files"`
+	Bytes       int64     `json:"bytes"`
+	Deleted     bool      `json:"deleted"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+type archiveKind int
+
+const (
+	kindZip archiveKind = iota
+	kindTar
+	kindTarGz
+	kindTarBz2
+	kindTarXz
+)
+
+type archiveSet struct {
+	kind    archiveKind
+	name    string   // arquivo principal, usado no relatório
+	base    string   // nome da subpasta de destino
+	volumes []string // em ordem de leitura
+	spanned bool     // zip dividido no formato .z01/.z02/.../.zip
+}
+
+var (
+	splitZipVolumeRe = regexp.MustCompile(`(?i)\.z\d{2,}$`)
+	rawZipVolumeRe   = regexp.MustCompile(`(?i)\.zip\.(\d{3})$`)
+)
+
+// ExtractArchives extrai os arquivos compactados suportados entre files
+// (caminhos absolutos) para uma subpasta ao lado de cada um. Entradas que
+// escapariam da subpasta abortam a extração daquele arquivo.
+func ExtractArchives(ctx context.Context, files []string, deleteArchives bool, progress ExtractProgress) []ExtractResult {
+	sets := findArchives(files)
+	results := make([]ExtractResult, 0, len(sets))
+
+	for _, set := range sets {
+		result := ExtractResult{
+			Archive: set.name,
+			Volumes: len(set.volumes),
+		}
+
+		dest, err := uniqueDir(filepath.Join(filepath.Dir(set.name), set.base))
+		if err == nil {
+			result.Destination = dest
+			result.Files, result.Bytes, err = extractSet(ctx, set, dest, progress)
+			if err != nil {
+				os.RemoveAll(dest)
+			}
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			if deleteArchives {
+				result.Deleted = true
+				for _, v := range set.volumes {
+					if rmErr := os.Remove(v); rmErr != nil {
+						result.Deleted = false
+					}
+				}
+			}
+		}
+		result.FinishedAt = time.Now()
+		results = append(results, result)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return results
+}
+
+func findArchives(files []string) []*archiveSet {
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		present[f] = true
+	}
+
+	var sets []*archiveSet
+	for _, f := range files {
+		lower := strings.ToLower(f)
+
+		switch {
+		case splitZipVolumeRe.MatchString(lower):
+			// Volume intermediário, tratado junto com o .zip
+			continue
+		case rawZipVolumeRe.MatchString(lower):
+			m := rawZipVolumeRe.FindStringSubmatch(lower)
+			if m[1] != "001" {
+				continue
+			}
+			prefix := f[:len(f)-len(".001")]
+			volumes := []string{f}
+			for n := 2; ; n++ {
+				next := fmt.Sprintf("%s.%03d", prefix, n)
+				if !present[next] {
+					break
+				}
+				volumes = append(volumes, next)
+			}
+			sets = append(sets, &archiveSet{
+				kind:    kindZip,
+				name:    f,
+				base:    trimExt(filepath.Base(prefix), ".zip"),
+				volumes: volumes,
+			})
+		case strings.HasSuffix(lower, ".zip"):
+			prefix := f[:len(f)-len(".zip")]
+			var volumes []string
+			for n := 1; ; n++ {
+				next := fmt.Sprintf("%s.z%02d", prefix, n)
+				if !present[next] {
+					if upper := fmt.Sprintf("%s.Z%02d", prefix, n); present[upper] {
+						next = upper
+					} else {
+						break
+					}
+				}
+				volumes = append(volumes, next)
+			}
+			sets = append(sets, &archiveSet{
+				kind:    kindZip,
+				name:    f,
+				base:    filepath.Base(prefix),
+				volumes: append(volumes, f),
+				spanned: len(volumes) > 0,
+			})
+		case strings.HasSuffix(lower, ".tar"):
+			sets = append(sets, singleVolume(kindTar, f, ".tar"))
+		case strings.HasSuffix(lower, ".tar.gz"):
+			sets = append(sets, singleVolume(kindTarGz, f, ".tar.gz"))
+		case strings.HasSuffix(lower, ".tgz"):
+			sets = append(sets, singleVolume(kindTarGz, f, ".tgz"))
+		case strings.HasSuffix(lower, ".tar.bz2"):
+			sets = append(sets, singleVolume(kindTarBz2, f, ".tar.bz2"))
+		case strings.HasSuffix(lower, ".tbz2"):
+			sets = append(sets, singleVolume(kindTarBz2, f, ".tbz2"))
+		case strings.HasSuffix(lower, ".tar.xz"):
+			sets = append(sets, singleVolume(kindTarXz, f, ".tar.xz"))
+		case strings.HasSuffix(lower, ".txz"):
+			sets = append(sets, singleVolume(kindTarXz, f, ".txz"))
+		}
+	}
+
+	sort.Slice(sets, func(i, j int) bool { return sets[i].name < sets[j].name })
+	return sets
+}
+
+func singleVolume(kind archiveKind, path, ext string) *archiveSet {
+	return &archiveSet{
+		kind:    kind,
+		name:    path,
+		base:    trimExt(filepath.Base(path), ext),
+		volumes: []string{path},
+	}
+}
+
+func trimExt(name, ext string) string {
+	if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+		return name[:len(name)-len(ext)]
+	}
+	return name
+}
+
+// uniqueDir evita sobrescrever uma pasta existente acrescentando um sufixo.
+func uniqueDir(dir string) (string, error) {
+	candidate := dir
+	for n := 1; n < 100; n++ {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate, os.MkdirAll(candidate, 0755)
+		}
+		candidate = fmt.Sprintf("%s (%d)", dir, n)
+	}
+	return "", fmt.Errorf("no free destination folder for %s", dir)
+}
+
+func extractSet(ctx context.Context, set *archiveSet, dest string, progress ExtractProgress) (int, int64, error) {
+	if set.kind == kindZip {
+		return extractZip(ctx, set, dest, progress)
+	}
+	return extractTar(ctx, set, dest, progress)
+}
+
+// safeJoin resolve name dentro de dest e rejeita caminhos absolutos ou que
+// escapem do destino.
+func safeJoin(dest, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("unsafe path in archive: %q", name)
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("unsafe path in archive: %q", name)
+	}
+	return target, nil
+}
+
+func extractZip(ctx context.Context, set *archiveSet, dest string, progress ExtractProgress) (int, int64, error) {
+	ra, size, closer, err := openVolumes(set)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closer()
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open zip: %w", err)
+	}
+
+	var total int64
+	for _, f := range zr.File {
+		if _, err := safeJoin(dest, f.Name); err != nil {
+			return 0, 0, err
+		}
+		total += int64(f.UncompressedSize64)
+	}
+
+	var files int
+	var done int64
+	for _, f := range zr.File {
+		target, _ := safeJoin(dest, f.Name)
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return files, done, err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return files, done, fmt.Errorf("open %s: %w", f.Name, err)
+		}
+		n, err := writeFile(ctx, target, rc, func(n int64) {
+			if progress != nil {
+				progress(set.name, done+n, total)
+			}
+		})
+		rc.Close()
+		done += n
+		if err != nil {
+			return files, done, err
+		}
+		files++
+	}
+	return files, done, nil
+}
+
+func extractTar(ctx context.Context, set *archiveSet, dest string, progress ExtractProgress) (int, int64, error) {
+	f, err := os.Open(set.volumes[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	raw := &countingReader{r: f}
+
+	var r io.Reader = raw
+	switch set.kind {
+	case kindTarGz:
+		gz, err := gzip.NewReader(raw)
+		if err != nil {
+			return 0, 0, fmt.Errorf("open gzip: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case kindTarBz2:
+		r = bzip2.NewReader(raw)
+	case kindTarXz:
+		xr, err := xz.NewReader(raw)
+		if err != nil {
+			return 0, 0, fmt.Errorf("open xz: %w", err)
+		}
+		r = xr
+	}
+
+	tr := tar.NewReader(r)
+	var files int
+	var written int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, written, nil
+		}
+		if err != nil {
+			return files, written, fmt.Errorf("read tar: %w", err)
+		}
+
+		target, err := safeJoin(dest, hdr.Name)
+		if err != nil {
+			return files, written, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return files, written, err
+			}
+		case tar.TypeReg:
+			n, err := writeFile(ctx, target, tr, func(int64) {
+				if progress != nil {
+					progress(set.name, raw.n, info.Size())
+				}
+			})
+			written += n
+			if err != nil {
+				return files, written, err
+			}
+			files++
+		default:
+			// Links e arquivos especiais são ignorados: um symlink poderia
+			// apontar para fora do destino.
+		}
+	}
+}
+
+func writeFile(ctx context.Context, target string, r io.Reader, onWrite func(n int64)) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	buf := make([]byte, 256<<10)
+	for {
+		if err := ctx.Err(); err != nil {
+			out.Close()
+			return written, err
+		}
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if _, err := out.Write(buf[:n]); err != nil {
+				out.Close()
+				return written, err
+			}
+			written += int64(n)
+			onWrite(written)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			out.Close()
+			return written, fmt.Errorf("extract %s: %w", filepath.Base(target), readErr)
+		}
+	}
+	return written, out.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// --- Zip em múltiplos volumes ---
+
+type volumeReader struct {
+	files   []*os.File
+	offsets []int64 // início de cada volume na sequência
+	size    int64
+	tail    []byte // diretório central reescrito, anexado ao final
+}
+
+func (v *volumeReader) ReadAt(p []byte, off int64) (int, error) {
+	total := v.size + int64(len(v.tail))
+	if off >= total {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for read < len(p) && off < total {
+		if off >= v.size {
+			n := copy(p[read:], v.tail[off-v.size:])
+			read += n
+			off += int64(n)
+			continue
+		}
+
+		i := sort.Search(len(v.offsets), func(i int) bool { return v.offsets[i] > off }) - 1
+		end := v.size
+		if i+1 < len(v.offsets) {
+			end = v.offsets[i+1]
+		}
+		chunk := p[read:]
+		if int64(len(chunk)) > end-off {
+			chunk = chunk[:end-off]
+		}
+		n, err := v.files[i].ReadAt(chunk, off-v.offsets[i])
+		read += n
+		off += int64(n)
+		if err != nil && err != io.EOF {
+			return read, err
+		}
+		if n == 0 {
+			return read, io.ErrUnexpectedEOF
+		}
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func openVolumes(set *archiveSet) (io.ReaderAt, int64, func(), error) {
+	v := &volumeReader{}
+	closer := func() {
+		for _, f := range v.files {
+			f.Close()
+		}
+	}
+
+	for _, path := range set.volumes {
+		f, err := os.Open(path)
+		if err != nil {
+			closer()
+			return nil, 0, nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			closer()
+			return nil, 0, nil, err
+		}
+		v.files = append(v.files, f)
+		v.offsets = append(v.offsets, v.size)
+		v.size += info.Size()
+	}
+
+	if set.spanned {
+		tail, err := rebuildSpannedDirectory(v)
+		if err != nil {
+			closer()
+			return nil, 0, nil, err
+		}
+		v.tail = tail
+	}
+
+	return v, v.size + int64(len(v.tail)), closer, nil
+}
+
+const (
+	eocdSignature      = 0x06054b50
+	centralDirSig      = 0x02014b50
+	eocdLen            = 22
+	centralDirEntryLen = 46
+)
+
+// rebuildSpannedDirectory reescreve o diretório central de um zip dividido
+// (.z01, .z02, ..., .zip), cujos offsets são relativos a cada volume, como
+// um diretório de volume único com offsets absolutos na sequência
+// concatenada. O resultado é anexado ao final para que archive/zip o leia.
+func rebuildSpannedDirectory(v *volumeReader) ([]byte, error) {
+	last := len(v.files) - 1
+	lastSize := v.size - v.offsets[last]
+
+	searchLen := int64(eocdLen + 0xffff)
+	if searchLen > lastSize {
+		searchLen = lastSize
+	}
+	buf := make([]byte, searchLen)
+	if _, err := v.files[last].ReadAt(buf, lastSize-searchLen); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read zip end record: %w", err)
+	}
+
+	pos := -1
+	for i := len(buf) - eocdLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) == eocdSignature {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil, errors.New("zip end record not found")
+	}
+	eocd := buf[pos : pos+eocdLen]
+
+	cdDisk := int(binary.LittleEndian.Uint16(eocd[6:]))
+	entries := int(binary.LittleEndian.Uint16(eocd[10:]))
+	cdSize := int64(binary.LittleEndian.Uint32(eocd[12:]))
+	cdOffset := int64(binary.LittleEndian.Uint32(eocd[16:]))
+	if entries == 0xffff || cdSize == 0xffffffff || cdOffset == 0xffffffff {
+		return nil, errors.New("zip64 multi-volume archives are not supported")
+	}
+	if cdDisk >= len(v.files) {
+		return nil, fmt.Errorf("missing zip volume %d", cdDisk+1)
+	}
+
+	cd := make([]byte, cdSize)
+	if _, err := v.ReadAt(cd, v.offsets[cdDisk]+cdOffset); err != nil {
+		return nil, fmt.Errorf("read central directory: %w", err)
+	}
+
+	for p, n := 0, 0; n < entries; n++ {
+		if p+centralDirEntryLen > len(cd) || binary.LittleEndian.Uint32(cd[p:]) != centralDirSig {
+			return nil, errors.New("corrupt central directory")
+		}
+		disk := int(binary.LittleEndian.Uint16(cd[p+34:]))
+		rel := int64(binary.LittleEndian.Uint32(cd[p+42:]))
+		if rel == 0xffffffff {
+			return nil, errors.New("zip64 multi-volume archives are not supported")
+		}
+		if disk >= len(v.files) {
+			return nil, fmt.Errorf("missing zip volume %d", disk+1)
+		}
+		abs := v.offsets[disk] + rel
+		if abs > 0xffffffff {
+			return nil, errors.New("multi-volume archive too large without zip64")
+		}
+		binary.LittleEndian.PutUint16(cd[p+34:], 0)
+		binary.LittleEndian.PutUint32(cd[p+42:], uint32(abs))
+
+		p += centralDirEntryLen + int(binary.LittleEndian.Uint16(cd[p+28:])) + int(binary.LittleEndian.Uint16(cd[p+30:])) + int(binary.LittleEndian.Uint16(cd[p+32:]))
+	}
+
+	if v.size > 0xffffffff {
+		return nil, errors.New("multi-volume archive too large without zip64")
+	}
+
+	end := make([]byte, eocdLen)
+	binary.LittleEndian.PutUint32(end[0:], eocdSignature)
+	binary.LittleEndian.PutUint16(end[8:], uint16(entries))
+	binary.LittleEndian.PutUint16(end[10:], uint16(entries))
+	binary.LittleEndian.PutUint32(end[12:], uint32(cdSize))
+	binary.LittleEndian.PutUint32(end[16:], uint32(v.size))
+
+	return append(cd, end...), nil
+}
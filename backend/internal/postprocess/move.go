@@ -0,0 +1,171 @@
+package postprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nebula/backend/internal/fileutil"
+)
+
+// MoveRule escolhe o destino de uma ação move/copy. A primeira regra cujos
+// critérios preenchidos batem com o download vence.
+type MoveRule struct {
+	Pattern     string            `json:"pattern,omitempty"`
+	FileType    fileutil.FileType `json:"file_type,omitempty"`
+	MinSize     int64             `json:"min_size,omitempty"`
+	Destination string            `json:"destination"`
+}
+
+func (r *MoveRule) matches(target *Target, dominant fileutil.FileType) bool {
+	if r.Pattern != "" {
+		ok, err := filepath.Match(strings.ToLower(r.Pattern), strings.ToLower(target.Name))
+		if err != nil || !ok {
+			return false
+		}
+	}
+	if r.FileType != "" && r.FileType != dominant {
+		return false
+	}
+	if r.MinSize > 0 && target.Size < r.MinSize {
+		return false
+	}
+	return true
+}
+
+func resolveDestination(action *Action, target *Target) (string, error) {
+	if len(action.Rules) > 0 {
+		dominant := dominantFileType(target.Path)
+		for i := range action.Rules {
+			if action.Rules[i].matches(target, dominant) {
+				return expand(action.Rules[i].Destination, target), nil
+			}
+		}
+	}
+	if action.Destination == "" {
+		return "", errors.New("no rule matched and no default destination")
+	}
+	return expand(action.Destination, target), nil
+}
+
+// dominantFileType retorna o tipo do maior arquivo em path.
+func dominantFileType(path string) fileutil.FileType {
+	var largest int64 = -1
+	dominant := fileutil.TypeOther
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.Size() > largest {
+			largest = info.Size()
+			dominant = fileutil.DetectFileType(p)
+		}
+		return nil
+	})
+	return dominant
+}
+
+func transfer(ctx context.Context, action *Action, target *Target) (string, error) {
+	destDir, err := resolveDestination(action, target)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(destDir) {
+		return "", fmt.Errorf("destination must be an absolute path: %s", destDir)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", fmt.Errorf("create destination: %w", err)
+	}
+
+	dest := filepath.Join(destDir, filepath.Base(target.Path))
+	if filepath.Clean(dest) == filepath.Clean(target.Path) {
+		return dest, nil
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("destination already exists: %s", dest)
+	}
+
+	if action.Type == ActionMove {
+		if err := os.Rename(target.Path, dest); err == nil {
+			target.Path = dest
+			return dest, nil
+		}
+		// Volumes diferentes: copia e remove a origem
+	}
+
+	if err := copyTree(ctx, target.Path, dest); err != nil {
+		os.RemoveAll(dest)
+		return "", err
+	}
+
+	if action.Type == ActionMove {
+		if err := os.RemoveAll(target.Path); err != nil {
+			return dest, fmt.Errorf("remove source after copy: %w", err)
+		}
+		target.Path = dest
+	}
+	return dest, nil
+}
+
+func copyTree(ctx context.Context, src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(out, 0755)
+		}
+		return copyFile(ctx, p, out)
+	})
+}
+
+func copyFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, &ctxReader{ctx: ctx, r: in}); err != nil {
+		out.Close()
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+	return out.Close()
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,163 @@
+package selection
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"nebula/backend/internal/fileutil"
+)
+
+// Rules escolhe arquivos de um torrent automaticamente. Critérios vazios são
+// ignorados; um arquivo precisa satisfazer todos os preenchidos. LargestN é
+// aplicado por último, sobre os arquivos que passaram pelos demais filtros.
+//
+// Padrões sem "/" são comparados com o nome do arquivo e com cada pasta do
+// caminho (exceto a raiz do torrent); padrões com "/" com o caminho completo. A comparação ignora
+// maiúsculas/minúsculas.
+type Rules struct {
+	Include      []string            `json:"include,omitempty"`
+	Exclude      []string            `json:"exclude,omitempty"`
+	Types        []fileutil.FileType `json:"types,omitempty"`
+	ExcludeTypes []fileutil.FileType `json:"exclude_types,omitempty"`
+	MinSize      int64               `json:"min_size,omitempty"`
+	MaxSize      int64               `json:"max_size,omitempty"`
+	LargestN     int                 `json:"largest_n,omitempty"`
+}
+
+// File é o mínimo que as regras precisam saber de um arquivo do torrent.
+type File struct {
+	Index int
+	Path  string
+	Size  int64
+}
+
+func (r *Rules) Validate() error {
+	for _, pattern := range append(append([]string{}, r.Include...), r.Exclude...) {
+		if strings.TrimSpace(pattern) == "" {
+			return errors.New("empty pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for _, t := range append(append([]fileutil.FileType{}, r.Types...), r.ExcludeTypes...) {
+		if _, ok := fileutil.TypeConfigs[t]; !ok && t != fileutil.TypeOther {
+			return fmt.Errorf("unknown file type: %q", t)
+		}
+	}
+	if r.MinSize < 0 || r.MaxSize < 0 {
+		return errors.New("sizes cannot be negative")
+	}
+	if r.MaxSize > 0 && r.MinSize > r.MaxSize {
+		return errors.New("min_size is greater than max_size")
+	}
+	if r.LargestN < 0 {
+		return errors.New("largest_n cannot be negative")
+	}
+	return nil
+}
+
+// Apply retorna os índices dos arquivos escolhidos, em ordem crescente.
+func (r *Rules) Apply(files []File) []int {
+	var matched []File
+	for _, f := range files {
+		if r.matches(f) {
+			matched = append(matched, f)
+		}
+	}
+
+	if r.LargestN > 0 && len(matched) > r.LargestN {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].Size > matched[j].Size
+		})
+		matched = matched[:r.LargestN]
+	}
+
+	indices := make([]int, len(matched))
+	for i, f := range matched {
+		indices[i] = f.Index
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+func (r *Rules) matches(f File) bool {
+	if r.MinSize > 0 && f.Size < r.MinSize {
+		return false
+	}
+	if r.MaxSize > 0 && f.Size > r.MaxSize {
+		return false
+	}
+
+	if len(r.Types) > 0 || len(r.ExcludeTypes) > 0 {
+		fileType := fileutil.DetectFileType(f.Path)
+		if len(r.Types) > 0 && !containsType(r.Types, fileType) {
+			return false
+		}
+		if containsType(r.ExcludeTypes, fileType) {
+			return false
+		}
+	}
+
+	if len(r.Include) > 0 && !matchAny(r.Include, f.Path) {
+		return false
+	}
+	return !matchAny(r.Exclude, f.Path)
+}
+
+func containsType(types []fileutil.FileType, t fileutil.FileType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, filePath string) bool {
+	filePath = strings.ToLower(strings.ReplaceAll(filePath, "\\", "/"))
+	parts := strings.Split(filePath, "/")
+	// A pasta raiz é o nome do torrent e não deve decidir a seleção
+	if len(parts) > 1 {
+		parts = parts[1:]
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, filePath); ok {
+				return true
+			}
+			continue
+		}
+		for _, part := range parts {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DefaultPresets são as regras nomeadas disponíveis numa configuração nova.
+func DefaultPresets() map[string]Rules {
+	return map[string]Rules{
+		"video-only": {
+			Types:   []fileutil.FileType{fileutil.TypeVideo},
+			Exclude: []string{"*sample*"},
+		},
+		"audio-only": {
+			Types: []fileutil.FileType{fileutil.TypeAudio},
+		},
+		"no-extras": {
+			Exclude:      []string{"*sample*", "*.nfo", "*.txt", "*.url"},
+			ExcludeTypes: []fileutil.FileType{fileutil.TypeExecutable},
+		},
+		"largest-file": {
+			LargestN: 1,
+		},
+	}
+}
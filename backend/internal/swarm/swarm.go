@@ -0,0 +1,297 @@
+// Package swarm estima a saúde de um torrent consultando trackers (scrape
+// HTTP e UDP) e amostrando peers no DHT, sempre com tempo limitado.
+package swarm
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+	MaxTimeout     = 30 * time.Second
+	// maxTrackers limita quantos trackers são consultados por análise
+	maxTrackers = 20
+)
+
+var ErrScrapeUnsupported = errors.New("tracker does not support scrape")
+
+type TrackerStats struct {
+	URL       string  `json:"url"`
+	Seeders   int     `json:"seeders"`
+	Leechers  int     `json:"leechers"`
+	Completed int     `json:"completed"`
+	Error     string  `json:"error,omitempty"`
+	Duration  float64 `json:"duration"` // segundos
+}
+
+type Health struct {
+	Trackers []TrackerStats `json:"trackers"`
+	// Seeders, Leechers e Completed são o maior valor informado por um
+	// tracker; somar contaria os mesmos peers várias vezes.
+	Seeders   int `json:"seeders"`
+	Leechers  int `json:"leechers"`
+	Completed int `json:"completed"`
+	DHTPeers  int `json:"dht_peers"`
+	// Score vai de 0 (sem peers) a 100.
+	Score     int       `json:"score"`
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// PeerSampler conta peers distintos encontrados no DHT até ctx expirar.
+type PeerSampler interface {
+	SampleDHTPeers(ctx context.Context, infoHash [20]byte) (int, error)
+}
+
+// Checker consulta trackers e DHT. O zero value usa http.DefaultClient e
+// não consulta o DHT.
+type Checker struct {
+	HTTPClient *http.Client
+	DHT        PeerSampler
+}
+
+// Check consulta trackers e DHT em paralelo e retorna antes de timeout.
+func (c *Checker) Check(ctx context.Context, infoHash string, trackers []string, timeout time.Duration) (*Health, error) {
+	ih, err := parseInfoHash(infoHash)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if timeout > MaxTimeout {
+		timeout = MaxTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	trackers = dedupe(trackers)
+	if len(trackers) > maxTrackers {
+		trackers = trackers[:maxTrackers]
+	}
+
+	health := &Health{Trackers: make([]TrackerStats, len(trackers))}
+
+	var wg sync.WaitGroup
+	for i, tr := range trackers {
+		wg.Add(1)
+		go func(i int, tr string) {
+			defer wg.Done()
+			health.Trackers[i] = c.scrape(ctx, tr, ih)
+		}(i, tr)
+	}
+
+	if c.DHT != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n, err := c.DHT.SampleDHTPeers(ctx, ih); err == nil {
+				health.DHTPeers = n
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, t := range health.Trackers {
+		if t.Error != "" {
+			continue
+		}
+		health.Seeders = max(health.Seeders, t.Seeders)
+		health.Leechers = max(health.Leechers, t.Leechers)
+		health.Completed = max(health.Completed, t.Completed)
+	}
+	health.Score = Score(health.Seeders, health.Leechers, health.DHTPeers)
+	health.Status = StatusFor(health.Score)
+	health.CheckedAt = time.Now()
+	return health, nil
+}
+
+// Score combina seeders, leechers e peers do DHT numa nota de 0 a 100.
+// Seeders pesam mais: sem eles o download pode nunca terminar. A escala é
+// logarítmica, então 1 seeder já dá nota razoável e 100+ saturam.
+func Score(seeders, leechers, dhtPeers int) int {
+	if seeders <= 0 && leechers <= 0 && dhtPeers <= 0 {
+		return 0
+	}
+	s := 70 * math.Min(1, math.Log10(float64(seeders)+1)/2)
+	l := 15 * math.Min(1, math.Log10(float64(leechers)+1)/2)
+	d := 15 * math.Min(1, math.Log10(float64(dhtPeers)+1)/2)
+	score := int(math.Round(s + l + d))
+	if score == 0 {
+		score = 1
+	}
+	return min(score, 100)
+}
+
+func StatusFor(score int) string {
+	switch {
+	case score == 0:
+		return "dead"
+	case score < 30:
+		return "poor"
+	case score < 55:
+		return "fair"
+	case score < 80:
+		return "good"
+	default:
+		return "excellent"
+	}
+}
+
+func (c *Checker) scrape(ctx context.Context, tracker string, ih [20]byte) TrackerStats {
+	start := time.Now()
+	stats := TrackerStats{URL: tracker}
+
+	var err error
+	u, parseErr := url.Parse(tracker)
+	switch {
+	case parseErr != nil:
+		err = parseErr
+	case u.Scheme == "http" || u.Scheme == "https":
+		err = c.scrapeHTTP(ctx, u, ih, &stats)
+	case u.Scheme == "udp":
+		err = scrapeUDP(ctx, u, ih, &stats)
+	default:
+		err = fmt.Errorf("unsupported tracker scheme: %q", u.Scheme)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out: %w", err)
+		}
+		stats.Error = err.Error()
+	}
+	stats.Duration = time.Since(start).Seconds()
+	return stats
+}
+
+type httpScrapeResponse struct {
+	Files         map[string]udp.ScrapeInfohashResult `bencode:"files"`
+	FailureReason string                              `bencode:"failure reason"`
+}
+
+// ScrapeURL converte a URL de announce na de scrape (convenção do BEP 48:
+// o último segmento precisa começar com "announce").
+func ScrapeURL(announce *url.URL) (*url.URL, error) {
+	i := strings.LastIndex(announce.Path, "/")
+	last := announce.Path[i+1:]
+	if !strings.HasPrefix(last, "announce") {
+		return nil, ErrScrapeUnsupported
+	}
+	scrape := *announce
+	scrape.Path = announce.Path[:i+1] + "scrape" + strings.TrimPrefix(last, "announce")
+	return &scrape, nil
+}
+
+func (c *Checker) scrapeHTTP(ctx context.Context, announce *url.URL, ih [20]byte, stats *TrackerStats) error {
+	scrapeURL, err := ScrapeURL(announce)
+	if err != nil {
+		return err
+	}
+	param := "info_hash=" + url.QueryEscape(string(ih[:]))
+	if scrapeURL.RawQuery != "" {
+		scrapeURL.RawQuery += "&" + param
+	} else {
+		scrapeURL.RawQuery = param
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scrapeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Nebula")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tracker returned %s", resp.Status)
+	}
+
+	var decoded httpScrapeResponse
+	if err := bencode.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("decode scrape response: %w", err)
+	}
+	if decoded.FailureReason != "" {
+		return errors.New(decoded.FailureReason)
+	}
+
+	result, ok := decoded.Files[string(ih[:])]
+	if !ok {
+		// Trackers omitem torrents que não conhecem
+		return nil
+	}
+	setResult(stats, result)
+	return nil
+}
+
+func scrapeUDP(ctx context.Context, announce *url.URL, ih [20]byte, stats *TrackerStats) error {
+	cc, err := udp.NewConnClient(udp.NewConnClientOpts{
+		Network: "udp",
+		Host:    announce.Host,
+	})
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	resp, err := cc.Client.Scrape(ctx, []udp.InfoHash{ih})
+	if err != nil {
+		return err
+	}
+	if len(resp) == 0 {
+		return errors.New("empty scrape response")
+	}
+	setResult(stats, resp[0])
+	return nil
+}
+
+func setResult(stats *TrackerStats, r udp.ScrapeInfohashResult) {
+	stats.Seeders = int(r.Seeders)
+	stats.Leechers = int(r.Leechers)
+	stats.Completed = int(r.Completed)
+}
+
+func parseInfoHash(s string) ([20]byte, error) {
+	var ih [20]byte
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != len(ih) {
+		return ih, fmt.Errorf("swarm health needs a v1 info hash, got %q", s)
+	}
+	copy(ih[:], raw)
+	return ih, nil
+}
+
+func dedupe(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package swarm
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/tracker/udp"
+)
+
+const testInfoHash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+type fakeSampler struct {
+	peers int
+	got   [20]byte
+}
+
+func (f *fakeSampler) SampleDHTPeers(ctx context.Context, infoHash [20]byte) (int, error) {
+	f.got = infoHash
+	return f.peers, nil
+}
+
+// scrapeTracker responde ao scrape com os números dados para testInfoHash.
+func scrapeTracker(t *testing.T, result udp.ScrapeInfohashResult) *httptest.Server {
+	t.Helper()
+	raw, _ := hex.DecodeString(testInfoHash)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("info_hash") != string(raw) {
+			t.Errorf("scrape info_hash = %x, want %s", r.URL.Query().Get("info_hash"), testInfoHash)
+		}
+		data, err := bencode.Marshal(httpScrapeResponse{
+			Files: map[string]udp.ScrapeInfohashResult{string(raw): result},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheck(t *testing.T) {
+	a := scrapeTracker(t, udp.ScrapeInfohashResult{Seeders: 25, Leechers: 3, Completed: 400})
+	b := scrapeTracker(t, udp.ScrapeInfohashResult{Seeders: 7, Leechers: 9, Completed: 120})
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	sampler := &fakeSampler{peers: 12}
+	checker := &Checker{HTTPClient: a.Client(), DHT: sampler}
+	trackers := []string{
+		a.URL + "/announce",
+		b.URL + "/announce",
+		a.URL + "/announce", // repetido
+		failing.URL + "/announce",
+		b.URL + "/tracker", // sem suporte a scrape
+	}
+
+	health, err := checker.Check(context.Background(), testInfoHash, trackers, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if len(health.Trackers) != 4 {
+		t.Fatalf("got %d trackers, want 4 (duplicates removed)", len(health.Trackers))
+	}
+	want := []TrackerStats{
+		{URL: a.URL + "/announce", Seeders: 25, Leechers: 3, Completed: 400},
+		{URL: b.URL + "/announce", Seeders: 7, Leechers: 9, Completed: 120},
+	}
+	for i, w := range want {
+		got := health.Trackers[i]
+		if got.Error != "" {
+			t.Errorf("tracker %d: unexpected error %q", i, got.Error)
+		}
+		if got.URL != w.URL || got.Seeders != w.Seeders || got.Leechers != w.Leechers || got.Completed != w.Completed {
+			t.Errorf("tracker %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if health.Trackers[2].Error == "" {
+		t.Errorf("failing tracker: expected an error")
+	}
+	if health.Trackers[3].Error != ErrScrapeUnsupported.Error() {
+		t.Errorf("tracker without scrape: error = %q, want %q", health.Trackers[3].Error, ErrScrapeUnsupported)
+	}
+
+	if hex.EncodeToString(sampler.got[:]) != testInfoHash {
+		t.Errorf("DHT sampled %x, want %s", sampler.got, testInfoHash)
+	}
+
+	// Totais são o maior valor por tracker, não a soma
+	if health.Seeders != 25 || health.Leechers != 9 || health.Completed != 400 || health.DHTPeers != 12 {
+		t.Errorf("totals = %d/%d/%d dht %d, want 25/9/400 dht 12",
+			health.Seeders, health.Leechers, health.Completed, health.DHTPeers)
+	}
+	if health.Score != 65 || health.Status != "good" {
+		t.Errorf("score = %d (%s), want 65 (good)", health.Score, health.Status)
+	}
+}
+
+func TestCheckInvalidInfoHash(t *testing.T) {
+	checker := &Checker{}
+	if _, err := checker.Check(context.Background(), "not-a-hash", nil, time.Second); err == nil {
+		t.Fatal("expected an error for an invalid info hash")
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		seeders, leechers, dht int
+		score                  int
+		status                 string
+	}{
+		{0, 0, 0, 0, "dead"},
+		{0, 1, 0, 2, "poor"},
+		{1, 0, 0, 11, "poor"},
+		{10, 5, 5, 48, "fair"},
+		{100, 100, 100, 100, "excellent"},
+		{5000, 5000, 5000, 100, "excellent"},
+	}
+	for _, tt := range tests {
+		score := Score(tt.seeders, tt.leechers, tt.dht)
+		if score != tt.score || StatusFor(score) != tt.status {
+			t.Errorf("Score(%d, %d, %d) = %d (%s), want %d (%s)",
+				tt.seeders, tt.leechers, tt.dht, score, StatusFor(score), tt.score, tt.status)
+		}
+	}
+}
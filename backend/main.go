@@ -3,14 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"math"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -19,7 +19,9 @@ import (
 	"nebula/backend/internal/api"
 	"nebula/backend/internal/config"
 	"nebula/backend/internal/downloader"
+	"nebula/backend/internal/handlers"
 	"nebula/backend/internal/logger"
+	"nebula/backend/internal/magnet"
 	"nebula/backend/internal/manager"
 	customMiddleware "nebula/backend/internal/middleware"
 
@@ -30,9 +32,7 @@ import (
 )
 
 const (
-	maxMultipartFormSize = 10 << 20
 	progressHubBufferSize = 256
-	defaultHistoryLimit = 100
 )
 
 type Server struct {
@@ -42,6 +42,10 @@ type Server struct {
 	torrentService  *downloader.Service
 	persistence     *downloader.PersistenceManager
 	progressHub     *ProgressHub
+	analysisJobs    *manager.AnalysisJobs
+	appDataDir      string
+	rateLimiter     *customMiddleware.RateLimiter
+	ipRateLimiter   *customMiddleware.IPRateLimiter
 }
 
 type ProgressHub struct {
@@ -196,12 +200,25 @@ func (r *HTTPProgressReporter) OnLog(id string, message string) {
 	})
 }
 
-func NewServer() (*Server, error) {
-	appDataDir := filepath.Join(os.Getenv("APPDATA"), "Nebula")
-	if os.Getenv("APPDATA") == "" {
-		home, _ := os.UserHomeDir()
-		appDataDir = filepath.Join(home, ".nebula")
+func (r *HTTPProgressReporter) OnEvent(id string, eventType string, data map[string]interface{}) {
+	payload := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		payload[k] = v
 	}
+	payload["type"] = eventType
+	r.hub.Broadcast(id, payload)
+}
+
+type httpReporterFactory struct {
+	hub *ProgressHub
+}
+
+func (f *httpReporterFactory) NewReporter() downloader.ProgressReporter {
+	return NewHTTPProgressReporter(f.hub)
+}
+
+func NewServer(opts *Options) (*Server, error) {
+	appDataDir := opts.DataDir
 
 	logDir := filepath.Join(appDataDir, "logs")
 	if err := logger.Init(logDir); err != nil {
@@ -213,14 +230,43 @@ func NewServer() (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("init api key: %w", err)
 	}
-	pm, err := downloader.NewPersistenceManager(appDataDir)
+	cm, err := config.NewConfigManager(opts.ConfigPath)
 	if err != nil {
-		return nil, fmt.Errorf("init persistence: %w", err)
+		return nil, fmt.Errorf("init config: %w", err)
+	}
+	if opts.DownloadDir != "" {
+		if err := cm.Override("default_download_dir", opts.DownloadDir); err != nil {
+			return nil, fmt.Errorf("download dir: %w", err)
+		}
+	}
+	if opts.LogLevel != "" {
+		if err := cm.Override("log_level", opts.LogLevel); err != nil {
+			return nil, fmt.Errorf("log level: %w", err)
+		}
 	}
+	cfg := cm.Get()
+	setLogLevel(cfg.LogLevel)
 
-	cm, err := config.NewConfigManager(appDataDir)
+	pm, err := downloader.NewPersistenceManager(appDataDir, cm.Get().PersistenceBackend)
 	if err != nil {
-		return nil, fmt.Errorf("init config: %w", err)
+		return nil, fmt.Errorf("init persistence: %w", err)
+	}
+	for _, r := range pm.Recoveries() {
+		if r.Backup != "" {
+			logger.Warn("%s was corrupted (%s), restored from %s", r.File, r.Error, r.Backup)
+		} else {
+			logger.Error("%s was corrupted (%s) and no valid backup was found, starting empty", r.File, r.Error)
+		}
+	}
+	api.RegisterHealthCheck("persistence", func() (string, interface{}) {
+		if recovered := pm.Recoveries(); len(recovered) > 0 {
+			return "recovered", map[string]interface{}{"recovered": recovered}
+		}
+		return "ok", nil
+	})
+
+	if err := pm.SetHistoryRetention(cm.HistoryRetention()); err != nil {
+		logger.Warn("failed to apply history retention: %v", err)
 	}
 
 	downloadConfig := &downloader.DownloadConfig{
@@ -228,12 +274,21 @@ func NewServer() (*Server, error) {
 		MaxUploadSpeed:   cm.GetMaxUploadSpeed(),
 	}
 
-	ts, err := downloader.NewService(downloadConfig, cm.Get().DefaultDownloadDir)
+	storageOpts := downloader.StorageOptions{
+		Backend:       cm.Get().StorageBackend,
+		CompletionDir: appDataDir,
+		TorrentDir:    filepath.Join(appDataDir, "torrents"),
+	}
+
+	ts, err := downloader.NewService(downloadConfig, cm.Get().DefaultDownloadDir, storageOpts)
 	if err != nil {
 		return nil, fmt.Errorf("init torrent service: %w", err)
 	}
 
-	dm := manager.NewDownloadManager(ts, pm)
+	ts.SetSpacePolicy(cm.Get().DiskReserve, cm.Get().LowSpacePolicy == "queue")
+	ts.SetPreallocate(cm.Get().Preallocate)
+
+	dm := manager.NewDownloadManager(ts, pm, cm)
 	hub := NewProgressHub()
 
 	s := &Server{
@@ -243,25 +298,89 @@ func NewServer() (*Server, error) {
 		torrentService:  ts,
 		persistence:     pm,
 		progressHub:     hub,
+		analysisJobs:    manager.NewAnalysisJobs(ts, hub.Broadcast),
+		appDataDir:      appDataDir,
+		rateLimiter:     customMiddleware.NewRateLimiter(rate.Limit(cfg.RateLimit), cfg.RateLimitBurst),
+		ipRateLimiter:   customMiddleware.NewIPRateLimiter(rate.Limit(cfg.IPRateLimit), cfg.IPRateLimitBurst),
 	}
+	cm.Subscribe(s.applyConfig)
 
 	s.setupRoutes()
 	return s, nil
 }
 
+// applyConfig aplica uma alteração da configuração, feita pela API ou no
+// arquivo, ao que roda sem reiniciar e a anuncia no SSE com id "config".
+func (s *Server) applyConfig(c config.Change) {
+	changed := make(map[string]bool, len(c.Changed))
+	for _, key := range c.Changed {
+		changed[key] = true
+	}
+	cfg := c.New
+
+	if changed["max_download_speed"] || changed["max_upload_speed"] {
+		s.torrentService.UpdateLimits(&downloader.DownloadConfig{
+			MaxDownloadSpeed: cfg.MaxDownloadSpeed * 1024,
+			MaxUploadSpeed:   cfg.MaxUploadSpeed * 1024,
+		})
+	}
+	if changed["disk_reserve"] || changed["low_space_policy"] {
+		s.torrentService.SetSpacePolicy(cfg.DiskReserve, cfg.LowSpacePolicy == "queue")
+	}
+	if changed["preallocate"] {
+		s.torrentService.SetPreallocate(cfg.Preallocate)
+	}
+	if changed["default_download_dir"] {
+		if err := s.torrentService.SetDataDir(cfg.DefaultDownloadDir); err != nil {
+			logger.Warn("failed to apply default download dir: %v", err)
+		}
+	}
+	if changed["history_max_entries"] || changed["history_max_age_days"] {
+		if err := s.persistence.SetHistoryRetention(s.configManager.HistoryRetention()); err != nil {
+			logger.Warn("failed to apply history retention: %v", err)
+		}
+	}
+	if changed["rate_limit"] || changed["rate_limit_burst"] {
+		s.rateLimiter.SetLimit(rate.Limit(cfg.RateLimit), cfg.RateLimitBurst)
+	}
+	if changed["ip_rate_limit"] || changed["ip_rate_limit_burst"] {
+		s.ipRateLimiter.SetLimit(rate.Limit(cfg.IPRateLimit), cfg.IPRateLimitBurst)
+	}
+	if changed["log_level"] {
+		setLogLevel(cfg.LogLevel)
+	}
+
+	restart := config.RestartRequired(c.Changed)
+	if len(restart) > 0 {
+		logger.Warn("config changed (%s): %s only apply after restart", c.Source, strings.Join(restart, ", "))
+	}
+	s.progressHub.Broadcast("config", map[string]interface{}{
+		"type":             "config_changed",
+		"source":           c.Source,
+		"changed":          c.Changed,
+		"restart_required": restart,
+	})
+}
+
+func setLogLevel(name string) {
+	level, err := logger.ParseLevel(name)
+	if err != nil {
+		logger.Warn("%v, keeping current level", err)
+		return
+	}
+	logger.SetLevel(level)
+}
+
 func (s *Server) setupRoutes() {
 	s.router.Use(middleware.RequestID)
 	s.router.Use(middleware.RealIP)
-	s.router.Use(middleware.Logger)
+	s.router.Use(customMiddleware.RequestLogger)
 	s.router.Use(customMiddleware.Recovery)
 	s.router.Use(middleware.Timeout(60 * time.Second))
 	s.router.Use(middleware.Compress(5))
 
-	rateLimiter := customMiddleware.NewRateLimiter(rate.Limit(100), 200)
-	s.router.Use(rateLimiter.Limit)
-
-	ipRateLimiter := customMiddleware.NewIPRateLimiter(rate.Limit(20), 50)
-	s.router.Use(ipRateLimiter.Limit)
+	s.router.Use(s.rateLimiter.Limit)
+	s.router.Use(s.ipRateLimiter.Limit)
 
 	s.router.Use(customMiddleware.APIKeyAuth)
 
@@ -271,30 +390,49 @@ func (s *Server) setupRoutes() {
 			"http://localhost:5173",
 			"http://127.0.0.1:5173",
 		},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Api-Key"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "X-Total-Count"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	deps := &handlers.Dependencies{
+		DownloadManager: s.downloadManager,
+		ConfigManager:   s.configManager,
+		TorrentService:  s.torrentService,
+		Persistence:     s.persistence,
+		ProgressHub:     s.progressHub,
+		AnalysisJobs:    s.analysisJobs,
+		AppDataDir:      s.appDataDir,
+	}
+	downloadHandler := handlers.NewDownloadHandler(deps, &httpReporterFactory{hub: s.progressHub})
+	configHandler := handlers.NewConfigHandler(deps)
+	torrentHandler := handlers.NewTorrentHandler(deps)
+	jobsHandler := handlers.NewJobsHandler(deps)
+	favoritesHandler := handlers.NewFavoritesHandler(deps)
+	historyHandler := handlers.NewHistoryHandler(deps)
+	backupHandler := handlers.NewBackupHandler(deps)
+
 	s.router.Get("/health", api.HandleHealth)
 	s.router.Get("/metrics", api.HandleMetrics)
 
 	s.router.Route("/api", func(r chi.Router) {
 		r.Route("/magnet", func(r chi.Router) {
-			r.Post("/analyze", s.handleAnalyzeMagnet)
-			r.Post("/download", s.handleDownload)
+			r.Post("/analyze", torrentHandler.HandleAnalyzeMagnet)
+			r.Post("/download", downloadHandler.HandleDownload)
+			r.Post("/bulk", downloadHandler.HandleBulk)
+			r.Post("/selection", torrentHandler.HandleResolveSelection)
 		})
 
 		r.Route("/torrent", func(r chi.Router) {
-			r.Post("/analyze", s.handleAnalyzeTorrentFile)
-			r.Post("/analyze-bytes", s.handleAnalyzeTorrentBytes)
+			r.Post("/analyze", torrentHandler.HandleAnalyzeTorrentFile)
+			r.Post("/analyze-bytes", torrentHandler.HandleAnalyzeTorrentBytes)
 		})
 
 		r.Route("/download", func(r chi.Router) {
 			r.Get("/", s.handleListDownloads)
-			r.Get("/{id}/status", s.handleGetDownloadStatus)
+			r.Get("/{id}/status", downloadHandler.HandleGetDownloadStatus)
 			r.Post("/{id}/pause", s.handlePauseDownload)
 			r.Post("/{id}/resume", s.handleResumeDownload)
 			r.Delete("/{id}", s.handleCancelDownload)
@@ -307,255 +445,90 @@ func (s *Server) setupRoutes() {
 		})
 
 		r.Route("/history", func(r chi.Router) {
-			r.Get("/", s.handleGetHistory)
-			r.Get("/search", s.handleSearchHistory)
+			r.Get("/", historyHandler.HandleGetHistory)
+			r.Delete("/", historyHandler.HandleClearHistory)
+			r.Get("/search", historyHandler.HandleSearchHistory)
+			r.Get("/export", historyHandler.HandleExportHistory)
+			r.Post("/import", historyHandler.HandleImportHistory)
+			r.Delete("/{id}", historyHandler.HandleDeleteHistory)
 		})
 
 		r.Route("/favorites", func(r chi.Router) {
-			r.Get("/", s.handleGetFavorites)
-			r.Post("/", s.handleAddFavorite)
-			r.Delete("/{id}", s.handleRemoveFavorite)
-			r.Get("/check", s.handleIsFavorite)
+			r.Get("/", favoritesHandler.HandleGetFavorites)
+			r.Post("/", favoritesHandler.HandleAddFavorite)
+			r.Get("/tags", favoritesHandler.HandleGetFavoriteTags)
+			r.Get("/export", favoritesHandler.HandleExportFavorites)
+			r.Post("/import", favoritesHandler.HandleImportFavorites)
+			r.Put("/{id}", favoritesHandler.HandleUpdateFavorite)
+			r.Delete("/{id}", favoritesHandler.HandleRemoveFavorite)
+			r.Post("/{id}/download", downloadHandler.HandleDownloadFavorite)
+			r.Get("/check", favoritesHandler.HandleIsFavorite)
 		})
 
 		r.Route("/config", func(r chi.Router) {
-			r.Get("/", s.handleGetConfig)
-			r.Put("/download-speed", s.handleSetMaxDownloadSpeed)
-			r.Put("/upload-speed", s.handleSetMaxUploadSpeed)
+			r.Get("/", configHandler.HandleGetConfig)
+			r.Patch("/", configHandler.HandlePatchConfig)
+			r.Get("/schema", configHandler.HandleGetConfigSchema)
+			r.Put("/download-speed", configHandler.HandleSetMaxDownloadSpeed)
+			r.Put("/upload-speed", configHandler.HandleSetMaxUploadSpeed)
 			r.Put("/default-dir", s.handleSetDefaultDir)
+			r.Put("/on-complete", configHandler.HandleSetOnCompleteActions)
+			r.Get("/history-retention", configHandler.HandleGetHistoryRetention)
+			r.Put("/history-retention", configHandler.HandleSetHistoryRetention)
+			r.Put("/disable-history", configHandler.HandleSetDisableHistory)
+			r.Get("/selection-presets", configHandler.HandleListSelectionPresets)
+			r.Put("/selection-presets/{name}", configHandler.HandleSetSelectionPreset)
+			r.Delete("/selection-presets/{name}", configHandler.HandleDeleteSelectionPreset)
+			r.Get("/download-presets", configHandler.HandleListDownloadPresets)
+			r.Get("/download-presets/{name}", configHandler.HandleGetDownloadPreset)
+			r.Put("/download-presets/{name}", configHandler.HandleSetDownloadPreset)
+			r.Delete("/download-presets/{name}", configHandler.HandleDeleteDownloadPreset)
 			r.Post("/reset", s.handleResetConfig)
 		})
 
+		r.Route("/jobs", func(r chi.Router) {
+			r.Get("/", jobsHandler.HandleListJobs)
+			r.Post("/", jobsHandler.HandleCreateJob)
+			r.Get("/{id}", jobsHandler.HandleGetJob)
+			r.Delete("/{id}", jobsHandler.HandleCancelJob)
+		})
+
+		r.Get("/backup", backupHandler.HandleBackup)
+		r.Post("/restore", backupHandler.HandleRestore)
+
 		r.Get("/file-types", s.handleGetFileTypes)
 		r.Get("/progress", s.handleProgressSSE)
 	})
 }
 
-func (s *Server) handleAnalyzeMagnet(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		MagnetLink string `json:"magnet_link"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("Failed to decode request: %v", err)
-		api.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Validar magnet link
-	if err := api.ValidateMagnetLink(req.MagnetLink); err != nil {
-		logger.Warn("Invalid magnet link: %v", err)
-		api.RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	files, name, err := s.torrentService.GetTorrentInfo(req.MagnetLink)
-	if err != nil {
-		logger.Error("Failed to get torrent info: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "Failed to analyze torrent")
-		return
-	}
-
-	infoHash := ""
-	if len(req.MagnetLink) > 20 {
-		start := len("magnet:?xt=urn:btih:")
-		if len(req.MagnetLink) > start+40 {
-			infoHash = req.MagnetLink[start : start+40]
+func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter downloader.DownloadFilter
+	for _, status := range strings.Split(query.Get("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			filter.Status = append(filter.Status, status)
 		}
 	}
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"files":       files,
-		"name":        name,
-		"info_hash":   infoHash,
-		"magnet_link": req.MagnetLink,
-		"total_size":  calculateTotalSize(files),
-	})
-}
-
-func calculateTotalSize(files []downloader.FileMetadata) int64 {
-	var total int64
-	for _, f := range files {
-		total += f.Size
-	}
-	return total
-}
-
-func (s *Server) handleAnalyzeTorrentFile(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(maxMultipartFormSize); err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse multipart form: %v", err))
-		return
-	}
-
-	file, _, err := r.FormFile("torrent")
-	if err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to get torrent file: %v", err))
-		return
-	}
-	defer file.Close()
-
-	data := make([]byte, maxMultipartFormSize)
-	n, err := file.Read(data)
-	if err != nil && err.Error() != "EOF" {
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("failed to read file: %v", err))
-		return
-	}
-
-	files, name, magnetLink, err := s.torrentService.AddTorrentFromBytes(data[:n])
-	if err != nil {
-		logger.Error("failed to analyze torrent file: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to analyze torrent file")
-		return
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"files":       files,
-		"name":        name,
-		"magnet_link": magnetLink,
-	})
-}
-
-func (s *Server) handleAnalyzeTorrentBytes(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Data []byte `json:"data"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
-		return
-	}
-
-	files, name, magnetLink, err := s.torrentService.AddTorrentFromBytes(req.Data)
-	if err != nil {
-		logger.Error("failed to analyze torrent bytes: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to analyze torrent data")
-		return
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"files":       files,
-		"name":        name,
-		"magnet_link": magnetLink,
-	})
-}
-
-func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		MagnetLink      string `json:"magnet_link"`
-		OutputDir       string `json:"output_dir"`
-		SelectedIndices []int  `json:"selected_indices"`
-		Sequential      bool   `json:"sequential"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		logger.Error("failed to decode download request", "error", err)
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
-		return
-	}
-
-	if req.MagnetLink == "" {
-		api.RespondWithError(w, http.StatusBadRequest, "magnet_link is required")
-		return
-	}
-
-	if req.OutputDir == "" {
-		cfg := s.configManager.Get()
-		req.OutputDir = cfg.DefaultDownloadDir
-	}
-
-	if err := api.ValidateOutputDir(req.OutputDir); err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	if len(req.SelectedIndices) == 0 {
-		api.RespondWithError(w, http.StatusBadRequest, "selected_indices cannot be empty")
-		return
-	}
-
-	for _, idx := range req.SelectedIndices {
-		if idx < 0 {
-			api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid file index: %d (must be non-negative)", idx))
+	if infoHash := query.Get("info_hash"); infoHash != "" {
+		ih, err := magnet.InfoHash(infoHash)
+		if err != nil {
+			api.RespondWithError(w, http.StatusBadRequest, "invalid info_hash")
 			return
 		}
+		filter.InfoHash = ih
 	}
 
-	record := &downloader.DownloadRecord{
-		ID:              "",
-		MagnetLink:      req.MagnetLink,
-		OutputDir:       req.OutputDir,
-		SelectedIndices: req.SelectedIndices,
-		Status:          "pending",
-		Progress:        0,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}
-
-	reporter := NewHTTPProgressReporter(s.progressHub)
-	id, err := s.downloadManager.StartDownload(r.Context(), req.MagnetLink, req.OutputDir, req.SelectedIndices, req.Sequential, reporter)
-	if err != nil {
-		logger.Error("failed to start download: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to start download")
-		return
-	}
-
-	record.ID = id
-	record.Status = "downloading"
-	record.TorrentName = "Processing..."
-	if err := s.persistence.SaveDownload(record); err != nil {
-		logger.Warn("failed to save download record", "error", err)
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]string{"id": id})
-}
-
-func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
-	status := r.URL.Query().Get("status")
-	
-	allDownloads, err := s.persistence.GetAllDownloads()
+	downloads, err := s.persistence.QueryDownloads(filter)
 	if err != nil {
 		logger.Error("failed to get downloads: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to retrieve downloads")
 		return
 	}
-
-	var filtered []*downloader.DownloadRecord
-	if status != "" {
-		for _, record := range allDownloads {
-			if record.Status == status {
-				filtered = append(filtered, record)
-			}
-		}
-	} else {
-		filtered = allDownloads
-	}
-
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].UpdatedAt.After(filtered[j].UpdatedAt)
-	})
-
-	api.RespondWithJSON(w, http.StatusOK, filtered)
-}
-
-func (s *Server) handleGetDownloadStatus(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		api.RespondWithError(w, http.StatusBadRequest, "download id required")
-		return
-	}
-
-	record, err := s.persistence.GetDownload(id)
-	if err != nil {
-		logger.Error("failed to get download: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to retrieve download")
-		return
-	}
-	if record == nil {
-		api.RespondWithError(w, http.StatusNotFound, "download not found")
-		return
+	if downloads == nil {
+		downloads = []*downloader.DownloadRecord{}
 	}
 
-	api.RespondWithJSON(w, http.StatusOK, record)
+	api.RespondWithJSON(w, http.StatusOK, downloads)
 }
 
 func (s *Server) handlePauseDownload(w http.ResponseWriter, r *http.Request) {
@@ -582,7 +555,7 @@ func (s *Server) handleCancelDownload(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	_ = s.downloadManager.CancelDownload(id)
 	
-	if err := s.persistence.DeleteDownload(id); err != nil {
+	if err := s.downloadManager.DeleteDownload(id); err != nil {
 		logger.Error("failed to delete download record: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to delete download record")
 		return
@@ -637,7 +610,7 @@ func (s *Server) handleDeleteDownloadFiles(w http.ResponseWriter, r *http.Reques
 		}
 	}
 	
-	if err := s.persistence.DeleteDownload(id); err != nil {
+	if err := s.downloadManager.DeleteDownload(id); err != nil {
 		logger.Error("failed to delete download record: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to delete download record")
 		return
@@ -681,216 +654,6 @@ func (s *Server) handleGetFilePriority(w http.ResponseWriter, r *http.Request) {
 	api.RespondWithJSON(w, http.StatusOK, map[string]int{"priority": int(priority)})
 }
 
-func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
-	limit := defaultHistoryLimit
-	fmt.Sscanf(r.URL.Query().Get("limit"), "%d", &limit)
-
-	records, err := s.persistence.GetHistory(limit)
-	if err != nil {
-		logger.Error("failed to get history: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to retrieve history")
-		return
-	}
-
-	dtos := make([]*downloader.HistoryRecordDTO, len(records))
-	for i, r := range records {
-		dtos[i] = r.ToDTO()
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, dtos)
-}
-
-func (s *Server) handleSearchHistory(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	records, err := s.persistence.SearchHistory(query)
-	if err != nil {
-		logger.Error("failed to search history: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to search history")
-		return
-	}
-
-	dtos := make([]*downloader.HistoryRecordDTO, len(records))
-	for i, r := range records {
-		dtos[i] = r.ToDTO()
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, dtos)
-}
-
-func (s *Server) handleGetFavorites(w http.ResponseWriter, r *http.Request) {
-	records, err := s.persistence.GetFavorites()
-	if err != nil {
-		api.RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	result := make([]map[string]interface{}, len(records))
-	for i, fav := range records {
-		result[i] = map[string]interface{}{
-			"id":          fmt.Sprintf("%d", fav.ID),
-			"name":        fav.TorrentName,
-			"magnet_link": fav.MagnetLink,
-			"created_at":  fav.AddedAt.Format(time.RFC3339),
-		}
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, result)
-}
-
-func (s *Server) handleAddFavorite(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		ID         string   `json:"id"`
-		Name       string   `json:"name"`
-		MagnetLink string   `json:"magnet_link"`
-		Tags       []string `json:"tags"`
-		Notes      string   `json:"notes"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
-	}
-
-	if req.MagnetLink == "" {
-		api.RespondWithError(w, http.StatusBadRequest, "magnet_link is required")
-		return
-	}
-
-	name := req.Name
-	if name == "" {
-		name = "Download Favorito"
-	}
-
-	if err := s.persistence.AddFavorite(req.MagnetLink, name, req.Tags, req.Notes); err != nil {
-		logger.Error("failed to add favorite: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to add favorite")
-		return
-	}
-	
-	api.RespondWithJSON(w, http.StatusCreated, map[string]string{"status": "created"})
-}
-
-func (s *Server) handleRemoveFavorite(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, "Invalid ID format")
-		return
-	}
-	
-	favorites, err := s.persistence.GetFavorites()
-	if err != nil {
-		api.RespondWithError(w, http.StatusInternalServerError, "Failed to get favorites")
-		return
-	}
-	
-	var targetMagnet string
-	for _, fav := range favorites {
-		if fav.ID == id {
-			targetMagnet = fav.MagnetLink
-			break
-		}
-	}
-	
-	if targetMagnet == "" {
-		api.RespondWithError(w, http.StatusNotFound, "Favorite not found")
-		return
-	}
-	
-	if err := s.persistence.RemoveFavorite(targetMagnet); err != nil {
-		logger.Error("failed to remove favorite: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to remove favorite")
-		return
-	}
-	
-	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
-}
-
-func (s *Server) handleIsFavorite(w http.ResponseWriter, r *http.Request) {
-	magnetLink := r.URL.Query().Get("magnet_link")
-	isFavorite, err := s.persistence.IsFavorite(magnetLink)
-	if err != nil {
-		logger.Error("failed to check favorite: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to check favorite status")
-		return
-	}
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]bool{"is_favorite": isFavorite})
-}
-
-func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
-	cfg := s.configManager.Get()
-	// Retornar valores em bytes/s para o frontend
-	api.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"max_download_speed": cfg.MaxDownloadSpeed,
-		"max_upload_speed":   cfg.MaxUploadSpeed,
-		"default_download_dir": cfg.DefaultDownloadDir,
-	})
-}
-
-func (s *Server) handleSetMaxDownloadSpeed(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Speed            int64 `json:"speed"`
-		MaxDownloadSpeed int64 `json:"max_download_speed"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
-		return
-	}
-
-	speed := req.Speed
-	if req.MaxDownloadSpeed > 0 {
-		speed = req.MaxDownloadSpeed
-	}
-
-	// Frontend envia em bytes/s, backend salva em bytes/s (não precisa converter)
-	if err := s.configManager.Set("max_download_speed", speed); err != nil {
-		logger.Error("failed to set max download speed: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to update download speed limit")
-		return
-	}
-
-	s.torrentService.UpdateLimits(&downloader.DownloadConfig{
-		MaxDownloadSpeed: s.configManager.Get().MaxDownloadSpeed,
-		MaxUploadSpeed:   s.configManager.Get().MaxUploadSpeed,
-	})
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
-}
-
-func (s *Server) handleSetMaxUploadSpeed(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Speed          int64 `json:"speed"`
-		MaxUploadSpeed int64 `json:"max_upload_speed"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		api.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
-		return
-	}
-
-	speed := req.Speed
-	if req.MaxUploadSpeed > 0 {
-		speed = req.MaxUploadSpeed
-	}
-
-	// Frontend envia em bytes/s, backend salva em bytes/s (não precisa converter)
-	if err := s.configManager.Set("max_upload_speed", speed); err != nil {
-		logger.Error("failed to set max upload speed: %v", err)
-		api.RespondWithError(w, http.StatusInternalServerError, "failed to update upload speed limit")
-		return
-	}
-
-	s.torrentService.UpdateLimits(&downloader.DownloadConfig{
-		MaxDownloadSpeed: s.configManager.Get().MaxDownloadSpeed,
-		MaxUploadSpeed:   s.configManager.Get().MaxUploadSpeed,
-	})
-
-	api.RespondWithJSON(w, http.StatusOK, map[string]string{"status": "updated"})
-}
-
 func (s *Server) handleSetDefaultDir(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		DefaultDownloadDir string `json:"default_download_dir"`
@@ -907,6 +670,11 @@ func (s *Server) handleSetDefaultDir(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.configManager.Set("default_download_dir", req.DefaultDownloadDir); err != nil {
+		var verr config.ValidationError
+		if errors.As(err, &verr) {
+			api.RespondWithError(w, http.StatusBadRequest, verr.Error())
+			return
+		}
 		logger.Error("failed to set default download dir: %v", err)
 		api.RespondWithError(w, http.StatusInternalServerError, "failed to update default directory")
 		return
@@ -1005,6 +773,15 @@ func (s *Server) Start(addr string) error {
 
 	s.loadIncompleteDownloads()
 
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	diskMonitor := manager.NewDiskMonitor(s.downloadManager, s.configManager, func(event string, data map[string]interface{}) {
+		data["type"] = event
+		s.progressHub.Broadcast("disk", data)
+	})
+	go diskMonitor.Run(monitorCtx)
+	go s.configManager.Watch(monitorCtx)
+	go s.persistence.RunHistoryRetention(monitorCtx)
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
@@ -1019,6 +796,8 @@ func (s *Server) Start(addr string) error {
 			logger.Error("server forced to shutdown: %v", err)
 		}
 		
+		stopMonitor()
+		s.analysisJobs.Shutdown()
 		s.downloadManager.Shutdown()
 		if s.torrentService != nil {
 			s.torrentService.Close()
@@ -1050,9 +829,19 @@ func (s *Server) loadIncompleteDownloads() {
 
 	reporter := NewHTTPProgressReporter(s.progressHub)
 	for _, record := range records {
-		if record.Status == "downloading" {
+		if record.Status == "downloading" || record.Status == "seeding" {
 			ctx := context.Background()
-			_, err := s.downloadManager.StartDownloadWithID(ctx, record.ID, record.MagnetLink, record.OutputDir, record.SelectedIndices, false, reporter)
+			opts := manager.DownloadOptions{
+				OnComplete:      record.OnComplete,
+				ExtractArchives: record.ExtractArchives,
+				SelectionPolicy: record.SelectionPolicy,
+				Rules:           record.SelectionRules,
+				Private:         record.Private,
+			}
+			if record.Transfer != nil {
+				opts.Transfer = *record.Transfer
+			}
+			_, err := s.downloadManager.StartDownloadWithID(ctx, record.ID, record.MagnetLink, record.OutputDir, record.SelectedIndices, record.Sequential, reporter, opts)
 			if err != nil {
 				logger.Warn("failed to resume download", "id", record.ID, "error", err)
 			}
@@ -1061,17 +850,28 @@ func (s *Server) loadIncompleteDownloads() {
 }
 
 func main() {
-	server, err := NewServer()
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	server, err := NewServer(opts)
 	if err != nil {
 		logger.Error("failed to create server", "error", err)
 		os.Exit(1)
 	}
 
-	addr := os.Getenv("NEBULA_ADDR")
-	if addr == "" {
-		addr = "127.0.0.1:8080"
+	if opts.Headless {
+		// Sem o app desktop o processo não deve cair quando o terminal fecha
+		signal.Ignore(syscall.SIGHUP)
+		logger.Info("running headless on %s, data in %s, API key in %s", opts.Addr, opts.DataDir, filepath.Join(opts.DataDir, ".api_key"))
 	}
 
+	addr := opts.Addr
 	if err := server.Start(addr); err != nil && err != http.ErrServerClosed {
 		logger.Error("server error", "error", err)
 		os.Exit(1)
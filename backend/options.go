@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"nebula/backend/internal/logger"
+)
+
+const defaultAddr = "127.0.0.1:8080"
+
+// Options são as opções de inicialização do backend. Cada uma vem, em ordem
+// de precedência, da flag, da variável de ambiente, de config.json (quando o
+// campo existe lá) e do padrão.
+type Options struct {
+	Addr        string
+	DataDir     string
+	ConfigPath  string
+	DownloadDir string
+	LogLevel    string
+	Headless    bool
+}
+
+// parseOptions lê as variáveis de ambiente e depois as flags de args. Os
+// valores do ambiente entram como padrão das flags.
+func parseOptions(args []string) (*Options, error) {
+	opts := &Options{
+		Addr:        envOr("NEBULA_ADDR", defaultAddr),
+		DataDir:     os.Getenv("NEBULA_DATA_DIR"),
+		ConfigPath:  os.Getenv("NEBULA_CONFIG"),
+		DownloadDir: os.Getenv("NEBULA_DOWNLOAD_DIR"),
+		LogLevel:    os.Getenv("NEBULA_LOG_LEVEL"),
+	}
+	if v := os.Getenv("NEBULA_HEADLESS"); v != "" {
+		headless, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("NEBULA_HEADLESS: invalid boolean %q", v)
+		}
+		opts.Headless = headless
+	}
+
+	fs := flag.NewFlagSet("nebula-backend", flag.ContinueOnError)
+	fs.StringVar(&opts.Addr, "addr", opts.Addr, "listen address (NEBULA_ADDR)")
+	fs.StringVar(&opts.DataDir, "data-dir", opts.DataDir, "directory for data, logs and the API key (NEBULA_DATA_DIR)")
+	fs.StringVar(&opts.ConfigPath, "config", opts.ConfigPath, "config file, default <data-dir>/config.json (NEBULA_CONFIG)")
+	fs.StringVar(&opts.DownloadDir, "download-dir", opts.DownloadDir, "default download directory, overrides default_download_dir (NEBULA_DOWNLOAD_DIR)")
+	fs.StringVar(&opts.LogLevel, "log-level", opts.LogLevel, "debug, info, warn or error, overrides log_level (NEBULA_LOG_LEVEL)")
+	fs.BoolVar(&opts.Headless, "headless", opts.Headless, "run without the desktop app (NEBULA_HEADLESS)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if opts.DataDir == "" {
+		dir, err := defaultDataDir()
+		if err != nil {
+			return nil, err
+		}
+		opts.DataDir = dir
+	}
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = filepath.Join(opts.DataDir, "config.json")
+	}
+	if opts.DownloadDir != "" {
+		dir, err := filepath.Abs(opts.DownloadDir)
+		if err != nil {
+			return nil, fmt.Errorf("download dir: %w", err)
+		}
+		opts.DownloadDir = dir
+	}
+	if opts.LogLevel != "" {
+		if _, err := logger.ParseLevel(opts.LogLevel); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// defaultDataDir segue a convenção de cada sistema: %APPDATA%\Nebula no
+// Windows, $XDG_CONFIG_HOME/Nebula (~/.config/Nebula) no Linux e
+// ~/Library/Application Support/Nebula no macOS. Instalações que ainda usam
+// ~/.nebula continuam nele.
+func defaultDataDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("data dir: %w", err)
+	}
+	dir := filepath.Join(configDir, "Nebula")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if home, err := os.UserHomeDir(); err == nil {
+			legacy := filepath.Join(home, ".nebula")
+			if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+				return legacy, nil
+			}
+		}
+	}
+	return dir, nil
+}
@@ -1,7 +1,69 @@
 #![cfg_attr(not(debug_assertions), windows_subsystem = "windows")]
 
+use std::path::PathBuf;
 use std::process::Command;
-use std::sync::{Arc, Mutex};
+use std::sync::{Arc, Mutex, OnceLock};
+
+/// Diretório de dados do backend (configuração, banco e API key), escolhido
+/// uma vez e passado em NEBULA_DATA_DIR para que app e backend usem o mesmo.
+static DATA_DIR: OnceLock<Result<PathBuf, String>> = OnceLock::new();
+
+fn data_dir() -> Result<PathBuf, String> {
+    DATA_DIR.get_or_init(resolve_data_dir).clone()
+}
+
+/// Mesmas regras de defaultDataDir em backend/options.go: NEBULA_DATA_DIR,
+/// senão {diretório de configuração}/Nebula, ou ~/.nebula em instalações
+/// antigas que ainda não têm o novo.
+fn resolve_data_dir() -> Result<PathBuf, String> {
+    if let Some(dir) = std::env::var_os("NEBULA_DATA_DIR").filter(|d| !d.is_empty()) {
+        return Ok(PathBuf::from(dir));
+    }
+
+    let dir = user_config_dir()?.join("Nebula");
+    if !dir.exists() {
+        if let Some(home) = home_dir() {
+            let legacy = home.join(".nebula");
+            if legacy.is_dir() {
+                return Ok(legacy);
+            }
+        }
+    }
+    Ok(dir)
+}
+
+/// Equivalente a os.UserConfigDir do Go.
+fn user_config_dir() -> Result<PathBuf, String> {
+    #[cfg(target_os = "windows")]
+    {
+        std::env::var_os("APPDATA")
+            .filter(|d| !d.is_empty())
+            .map(PathBuf::from)
+            .ok_or_else(|| "Failed to get app data dir: %APPDATA% is not defined".to_string())
+    }
+    #[cfg(target_os = "macos")]
+    {
+        home_dir()
+            .map(|h| h.join("Library").join("Application Support"))
+            .ok_or_else(|| "Failed to get app data dir: $HOME is not defined".to_string())
+    }
+    #[cfg(not(any(target_os = "windows", target_os = "macos")))]
+    {
+        if let Some(dir) = std::env::var_os("XDG_CONFIG_HOME").map(PathBuf::from) {
+            if dir.is_absolute() {
+                return Ok(dir);
+            }
+        }
+        home_dir()
+            .map(|h| h.join(".config"))
+            .ok_or_else(|| "Failed to get app data dir: $HOME is not defined".to_string())
+    }
+}
+
+fn home_dir() -> Option<PathBuf> {
+    let var = if cfg!(target_os = "windows") { "USERPROFILE" } else { "HOME" };
+    std::env::var_os(var).filter(|h| !h.is_empty()).map(PathBuf::from)
+}
 
 struct BackendProcess {
     process: Option<std::process::Child>,
@@ -77,6 +139,7 @@ impl BackendProcess {
 
         let mut cmd = Command::new(&backend_path);
         cmd.env("NEBULA_ADDR", "127.0.0.1:8080");
+        cmd.env("NEBULA_DATA_DIR", data_dir()?);
         
         if cfg!(debug_assertions) {
             cmd.env("NEBULA_DEV", "true");
@@ -130,13 +193,8 @@ fn get_backend_url() -> String {
 #[tauri::command]
 fn get_api_key() -> Result<String, String> {
     use std::fs;
-    use std::path::PathBuf;
-    
-    let app_data = std::env::var("APPDATA")
-        .or_else(|_| std::env::var("HOME").map(|h| format!("{}/.config", h)))
-        .map_err(|e| format!("Failed to get app data dir: {}", e))?;
     
-    let key_path = PathBuf::from(app_data).join("Nebula").join(".api_key");
+    let key_path = data_dir()?.join(".api_key");
     
     if !key_path.exists() {
         return Err("API Key not found. Backend may not be running.".to_string());